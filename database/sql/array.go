@@ -0,0 +1,153 @@
+package sql
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// 将数组类型的列扫描到dest指向的切片中
+// 支持PostgreSQL数组字面量、JSON数组以及驱动原生返回的[]driver.Value
+func Array(dest interface{}) Scanner {
+	return arrayScanner{dest: dest}
+}
+
+type arrayScanner struct {
+	dest interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (a arrayScanner) Scan(src interface{}) error {
+	dv := reflect.ValueOf(a.dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("sql: Array destination must be a non-nil pointer to a slice, not %T", a.dest)
+	}
+	sv := dv.Elem()
+	var elems []driver.Value
+	switch s := src.(type) {
+	case nil:
+		sv.Set(reflect.Zero(sv.Type()))
+		return nil
+	case []driver.Value:
+		elems = s
+	case []byte:
+		return a.scanText(sv, string(s))
+	case string:
+		return a.scanText(sv, s)
+	default:
+		return fmt.Errorf("sql: cannot scan %T into Array", src)
+	}
+	return assignArray(sv, elems)
+}
+
+func (a arrayScanner) scanText(sv reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") {
+		return json.Unmarshal([]byte(s), a.dest)
+	}
+	elems, err := parsePostgresArray(s)
+	if err != nil {
+		return err
+	}
+	if sv.Type().Elem().Kind() == reflect.Slice && sv.Type().Elem().Elem().Kind() == reflect.Uint8 {
+		for i, e := range elems {
+			if str, ok := e.(string); ok && strings.HasPrefix(str, `\x`) {
+				b, err := hex.DecodeString(str[2:])
+				if err != nil {
+					return fmt.Errorf("sql: array element %d: %v", i, err)
+				}
+				elems[i] = b
+			}
+		}
+	}
+	return assignArray(sv, elems)
+}
+
+func assignArray(sv reflect.Value, elems []driver.Value) error {
+	out := reflect.MakeSlice(sv.Type(), len(elems), len(elems))
+	et := sv.Type().Elem()
+	for i, e := range elems {
+		if e == nil {
+			continue
+		}
+		if et == timeType {
+			if str, ok := e.(string); ok {
+				t, err := driver.Time.ConvertValue(str)
+				if err != nil {
+					return fmt.Errorf("sql: array element %d: %v", i, err)
+				}
+				e = t
+			}
+		}
+		if err := convertAssign(out.Index(i).Addr().Interface(), e); err != nil {
+			return fmt.Errorf("sql: array element %d: %v", i, err)
+		}
+	}
+	sv.Set(out)
+	return nil
+}
+
+var errArraySyntax = errors.New("sql: malformed array literal")
+
+// 解析一维的PostgreSQL数组字面量, 未加引号的NULL解析为nil
+func parsePostgresArray(s string) ([]driver.Value, error) {
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, errArraySyntax
+	}
+	s = s[1 : len(s)-1]
+	var elems []driver.Value
+	if s == "" {
+		return elems, nil
+	}
+	for i := 0; ; {
+		if i < len(s) && s[i] == '{' {
+			return nil, errors.New("sql: multi-dimensional arrays are not supported")
+		}
+		var elem driver.Value
+		if i < len(s) && s[i] == '"' {
+			var b strings.Builder
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+					if i == len(s) {
+						return nil, errArraySyntax
+					}
+				}
+				b.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errArraySyntax
+			}
+			i++
+			elem = b.String()
+		} else {
+			j := strings.IndexByte(s[i:], ',')
+			if j < 0 {
+				j = len(s) - i
+			}
+			tok := strings.TrimSpace(s[i : i+j])
+			if tok == "" {
+				return nil, errArraySyntax
+			}
+			if !strings.EqualFold(tok, "NULL") {
+				elem = tok
+			}
+			i += j
+		}
+		elems = append(elems, elem)
+		if i == len(s) {
+			return elems, nil
+		}
+		if s[i] != ',' {
+			return nil, errArraySyntax
+		}
+		i++
+	}
+}
@@ -0,0 +1,63 @@
+package sql
+
+import (
+	"github.com/dimdark/gdk/database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArrayScan(t *testing.T) {
+	var ints []int64
+	if err := Array(&ints).Scan([]driver.Value{int64(1), nil, "3"}); err != nil || !reflect.DeepEqual(ints, []int64{1, 0, 3}) {
+		t.Errorf("native scan = %v, %v; want [1 0 3]", ints, err)
+	}
+
+	var strs []NullString
+	if err := Array(&strs).Scan([]byte(`{"a\"b",NULL,"NULL", c }`)); err != nil {
+		t.Fatal(err)
+	}
+	want := []NullString{{`a"b`, true}, {}, {"NULL", true}, {"c", true}}
+	if !reflect.DeepEqual(strs, want) {
+		t.Errorf("literal scan = %v; want %v", strs, want)
+	}
+
+	var bs [][]byte
+	if err := Array(&bs).Scan(`{"\\xabcd"}`); err != nil || !reflect.DeepEqual(bs, [][]byte{{0xab, 0xcd}}) {
+		t.Errorf("bytea scan = %v, %v", bs, err)
+	}
+
+	var ts []time.Time
+	at := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := Array(&ts).Scan(`{"2019-03-04T05:06:07Z"}`); err != nil || len(ts) != 1 || !ts[0].Equal(at) {
+		t.Errorf("time scan = %v, %v; want [%v]", ts, err, at)
+	}
+
+	var fs []float64
+	if err := Array(&fs).Scan([]byte(" [1.5, 2] ")); err != nil || !reflect.DeepEqual(fs, []float64{1.5, 2}) {
+		t.Errorf("JSON scan = %v, %v; want [1.5 2]", fs, err)
+	}
+
+	if err := Array(&fs).Scan(nil); err != nil || fs != nil {
+		t.Errorf("NULL scan = %v, %v; want nil slice", fs, err)
+	}
+	if err := Array(&ints).Scan("{}"); err != nil || ints == nil || len(ints) != 0 {
+		t.Errorf("empty array scan = %#v, %v; want an empty slice", ints, err)
+	}
+}
+
+func TestArrayScanErrors(t *testing.T) {
+	var ints []int64
+	for _, src := range []interface{}{"1,2", "{1,,2}", `{"a}`, "{{1},{2}}", "{a}", int64(1)} {
+		if err := Array(&ints).Scan(src); err == nil {
+			t.Errorf("Scan(%v) succeeded with %v", src, ints)
+		}
+	}
+	var n int
+	if err := Array(&n).Scan("{1}"); err == nil {
+		t.Error("Scan into a non-slice destination succeeded")
+	}
+	if err := Array(ints).Scan("{1}"); err == nil {
+		t.Error("Scan into a non-pointer destination succeeded")
+	}
+}
@@ -0,0 +1,142 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+// 实现driver.Batcher的连接, 值为"bad"的行失败; 不应走到Begin和Prepare
+type batchConn struct {
+	driver.Conn
+	batches [][][]driver.NamedValue
+}
+
+func (c *batchConn) Close() error { return nil }
+func (c *batchConn) ExecBatch(ctx context.Context, query string, rows [][]driver.NamedValue) (driver.Result, error) {
+	c.batches = append(c.batches, rows)
+	for i, row := range rows {
+		if row[0].Value == "bad" {
+			return nil, &driver.BatchError{Index: i, Err: errors.New("bad row")}
+		}
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+// 不支持Batcher的连接, 记录预编译、执行的参数以及事务的结束方式
+type batchStmtConn struct {
+	driver.Conn
+	prepares int
+	rows []driver.Value
+	committed, rolledBack bool
+}
+
+func (c *batchStmtConn) Close() error              { return nil }
+func (c *batchStmtConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *batchStmtConn) Commit() error {
+	c.committed = true
+	return nil
+}
+func (c *batchStmtConn) Rollback() error {
+	c.rolledBack = true
+	return nil
+}
+func (c *batchStmtConn) Prepare(query string) (driver.Stmt, error) {
+	c.prepares++
+	return batchStmt{c}, nil
+}
+
+type batchStmt struct {
+	c *batchStmtConn
+}
+
+func (s batchStmt) Close() error  { return nil }
+func (s batchStmt) NumInput() int { return 1 }
+func (s batchStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if args[0] == "bad" {
+		return nil, errors.New("bad row")
+	}
+	s.c.rows = append(s.c.rows, args[0])
+	return driver.RowsAffected(1), nil
+}
+func (s batchStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+type batchConnector struct {
+	c driver.Conn
+}
+
+func (p batchConnector) Connect(context.Context) (driver.Conn, error) { return p.c, nil }
+func (p batchConnector) Driver() driver.Driver                        { return nil }
+
+func TestExecBatchBatcher(t *testing.T) {
+	c := &batchConn{}
+	db := OpenDB(batchConnector{c})
+	res, err := db.ExecBatch(context.Background(), "insert", [][]interface{}{{"a"}, {int32(2)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("RowsAffected = %d; want 2", n)
+	}
+	// 参数经过默认转换后一次交给驱动
+	want := [][]driver.NamedValue{
+		{{Ordinal: 1, Value: "a"}},
+		{{Ordinal: 1, Value: int64(2)}},
+	}
+	if len(c.batches) != 1 || !reflect.DeepEqual(c.batches[0], want) {
+		t.Errorf("batches = %v; want one batch %v", c.batches, want)
+	}
+
+	_, err = db.ExecBatch(context.Background(), "insert", [][]interface{}{{"a"}, {"b"}, {"bad"}})
+	be, ok := err.(*BatchError)
+	if !ok || be.Index != 2 || be.Err.Error() != "bad row" {
+		t.Errorf("ExecBatch = %v; want BatchError at row 2", err)
+	}
+}
+
+func TestExecBatchFallback(t *testing.T) {
+	c := &batchStmtConn{}
+	db := OpenDB(batchConnector{c})
+	res, err := db.ExecBatch(context.Background(), "insert", [][]interface{}{{"a"}, {"b"}, {"c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Errorf("RowsAffected = %d; want 3", n)
+	}
+	// 在一个事务中只预编译一次
+	if c.prepares != 1 || !c.committed || c.rolledBack {
+		t.Errorf("prepares = %d, committed = %v, rolledBack = %v; want 1 prepare in a committed tx", c.prepares, c.committed, c.rolledBack)
+	}
+	if want := []driver.Value{"a", "b", "c"}; !reflect.DeepEqual(c.rows, want) {
+		t.Errorf("rows = %v; want %v", c.rows, want)
+	}
+
+	c = &batchStmtConn{}
+	db = OpenDB(batchConnector{c})
+	_, err = db.ExecBatch(context.Background(), "insert", [][]interface{}{{"a"}, {"bad"}, {"c"}})
+	be, ok := err.(*BatchError)
+	if !ok || be.Index != 1 {
+		t.Fatalf("ExecBatch = %v; want BatchError at row 1", err)
+	}
+	if c.committed || !c.rolledBack {
+		t.Errorf("committed = %v, rolledBack = %v; want the batch rolled back", c.committed, c.rolledBack)
+	}
+}
+
+func TestExecBatchBadArg(t *testing.T) {
+	c := &batchConn{}
+	db := OpenDB(batchConnector{c})
+	_, err := db.ExecBatch(context.Background(), "insert", [][]interface{}{{"a"}, {struct{}{}}})
+	be, ok := err.(*BatchError)
+	if !ok || be.Index != 1 {
+		t.Errorf("ExecBatch = %v; want BatchError at row 1", err)
+	}
+	if len(c.batches) != 0 {
+		t.Error("batch with an unconvertible argument reached the driver")
+	}
+}
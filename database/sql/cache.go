@@ -0,0 +1,272 @@
+package sql
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缓存查询结果, 按查询语句和参数作为key, 超过ttl或总大小超过maxBytes时淘汰
+type QueryCache struct {
+	db *DB
+	ttl time.Duration
+	maxBytes int64
+
+	mu sync.Mutex
+	// Invalidate和Purge时递增, 在此之前开始的加载结果不再写入缓存
+	gen uint64
+	size int64
+	entries map[string]*list.Element
+	lru *list.List
+	tags map[string]map[string]struct{}
+}
+
+type cacheEntry struct {
+	key string
+	columns []string
+	rows [][]driver.Value
+	tags []string
+	expires time.Time
+	size int64
+}
+
+func NewQueryCache(db *DB, ttl time.Duration, maxBytes int64) *QueryCache {
+	return &QueryCache{
+		db: db,
+		ttl: ttl,
+		maxBytes: maxBytes,
+		entries: make(map[string]*list.Element),
+		lru: list.New(),
+		tags: make(map[string]map[string]struct{}),
+	}
+}
+
+func (c *QueryCache) QueryContext(ctx context.Context, tags []string, query string, args ...interface{}) (*Rows, error) {
+	key, err := c.db.cacheKey(query, args)
+	if err != nil {
+		// 参数无法用默认转换器转换(如驱动自定义的类型)时不经过缓存
+		return c.db.QueryContext(ctx, query, args...)
+	}
+	e, gen := c.get(key)
+	if e != nil {
+		return newRows(c.db, &cachedRows{columns: e.columns, rows: e.rows}), nil
+	}
+	e, err = c.load(ctx, key, query, args)
+	if err != nil {
+		return nil, err
+	}
+	e.tags = tags
+	c.put(e, gen)
+	return newRows(c.db, &cachedRows{columns: e.columns, rows: e.rows}), nil
+}
+
+func (c *QueryCache) load(ctx context.Context, key, query string, args []interface{}) (*cacheEntry, error) {
+	qctx, cancel := c.db.queryContext(ctx)
+	defer cancel()
+	ci, err := c.db.connect(qctx)
+	if err != nil {
+		return nil, timeoutErr(ctx, qctx, err, ErrQueryTimeout)
+	}
+	nvargs, err := c.db.driverArgs(ci, args)
+	if err != nil {
+		c.db.putConn(ci, err)
+		return nil, err
+	}
+	rows, done, err := ctxDriverConnQuery(qctx, ci, query, nvargs)
+	if err != nil {
+		c.db.putConn(ci, err)
+		return nil, timeoutErr(ctx, qctx, err, ErrQueryTimeout)
+	}
+	e, err := materializeRows(rows)
+	rows.Close()
+	done()
+	c.db.putConn(ci, err)
+	if err != nil {
+		return nil, err
+	}
+	e.key = key
+	return e, nil
+}
+
+func materializeRows(rows driver.Rows) (*cacheEntry, error) {
+	e := &cacheEntry{columns: rows.Columns()}
+	for {
+		dest := make([]driver.Value, len(e.columns))
+		err := rows.Next(dest)
+		if err == io.EOF {
+			return e, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range dest {
+			if b, ok := v.([]byte); ok {
+				dest[i] = append([]byte(nil), b...)
+			}
+			e.size += valueSize(dest[i])
+		}
+		e.rows = append(e.rows, dest)
+	}
+}
+
+func valueSize(v driver.Value) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(len(v)) + 16
+	case []byte:
+		return int64(len(v)) + 24
+	case time.Time:
+		return 24
+	}
+	return 16
+}
+
+// 参数先按传给驱动的方式转换, 以转换后的值作为key,
+// 避免指针参数按地址、Valuer参数按自身的格式化结果区分;
+// 每一段都带长度前缀, 不同的参数列表不会拼出相同的key
+func (db *DB) cacheKey(query string, args []interface{}) (string, error) {
+	nvargs, err := db.driverArgs(nil, args)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	writeKeyPart(&b, query)
+	for _, nv := range nvargs {
+		writeKeyPart(&b, nv.Name)
+		switch v := nv.Value.(type) {
+		case []byte:
+			writeKeyPart(&b, fmt.Sprintf("[]byte:%x", v))
+		case time.Time:
+			writeKeyPart(&b, "time:"+v.Format(time.RFC3339Nano))
+		default:
+			writeKeyPart(&b, fmt.Sprintf("%T:%v", v, v))
+		}
+	}
+	return b.String(), nil
+}
+
+func writeKeyPart(b *strings.Builder, s string) {
+	b.WriteString(strconv.Itoa(len(s)))
+	b.WriteByte(':')
+	b.WriteString(s)
+}
+
+// 未命中时返回nil和当前的代数, 加载完成后凭此写入
+func (c *QueryCache) get(key string) (*cacheEntry, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, c.gen
+	}
+	e := el.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(e.expires) {
+		c.removeLocked(el)
+		return nil, c.gen
+	}
+	c.lru.MoveToFront(el)
+	return e, c.gen
+}
+
+// 加载期间发生过Invalidate或Purge时丢弃结果, 以免写回已失效的数据
+func (c *QueryCache) put(e *cacheEntry, gen uint64) {
+	if c.maxBytes > 0 && e.size > c.maxBytes {
+		return
+	}
+	e.expires = time.Now().Add(c.ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return
+	}
+	if el, ok := c.entries[e.key]; ok {
+		c.removeLocked(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += e.size
+	for _, tag := range e.tags {
+		keys := c.tags[tag]
+		if keys == nil {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[e.key] = struct{}{}
+	}
+	for c.maxBytes > 0 && c.size > c.maxBytes {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *QueryCache) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	for _, tag := range e.tags {
+		if keys := c.tags[tag]; keys != nil {
+			delete(keys, e.key)
+			if len(keys) == 0 {
+				delete(c.tags, tag)
+			}
+		}
+	}
+}
+
+func (c *QueryCache) Invalidate(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key := range c.tags[tag] {
+		if el, ok := c.entries[key]; ok {
+			c.removeLocked(el)
+		}
+	}
+}
+
+func (c *QueryCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.tags = make(map[string]map[string]struct{})
+	c.size = 0
+}
+
+// 回放缓存中的结果集
+type cachedRows struct {
+	columns []string
+	rows [][]driver.Value
+	pos int
+}
+
+var _ driver.Rows = (*cachedRows)(nil)
+
+func (r *cachedRows) Columns() []string {
+	return r.columns
+}
+
+func (r *cachedRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	// 缓存中的[]byte被多个结果集共享, 复制一份以免扫描到*RawBytes的目标直接指向缓存
+	for i, v := range r.rows[r.pos] {
+		if b, ok := v.([]byte); ok {
+			v = append([]byte(nil), b...)
+		}
+		dest[i] = v
+	}
+	r.pos++
+	return nil
+}
+
+func (r *cachedRows) Close() error {
+	r.pos = len(r.rows)
+	return nil
+}
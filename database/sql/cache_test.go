@@ -0,0 +1,189 @@
+package sql
+
+import (
+	"context"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 每次查询返回一行(第几次查询, "v"); 设置了block时查询先通知started再等待block
+type cacheConnector struct {
+	mu sync.Mutex
+	queries int
+	started chan struct{}
+	block chan struct{}
+}
+
+type cacheConn struct {
+	driver.Conn
+	p *cacheConnector
+}
+
+func (p *cacheConnector) Connect(context.Context) (driver.Conn, error) {
+	return &cacheConn{p: p}, nil
+}
+func (p *cacheConnector) Driver() driver.Driver { return nil }
+
+func (p *cacheConnector) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queries
+}
+
+func (c *cacheConn) Close() error { return nil }
+func (c *cacheConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.p.mu.Lock()
+	c.p.queries++
+	n := c.p.queries
+	started, block := c.p.started, c.p.block
+	c.p.mu.Unlock()
+	if block != nil {
+		started <- struct{}{}
+		<-block
+	}
+	return &apiRows{data: [][]driver.Value{{int64(n), []byte("v")}}}, nil
+}
+
+func cacheQuery(t *testing.T, c *QueryCache, tags []string, args ...interface{}) int64 {
+	t.Helper()
+	rows, err := c.QueryContext(context.Background(), tags, "select", args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("no rows: %v", rows.Err())
+	}
+	var n int64
+	var s string
+	if err := rows.Scan(&n, &s); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestQueryCacheHit(t *testing.T) {
+	p := &cacheConnector{}
+	c := NewQueryCache(OpenDB(p), time.Minute, 0)
+	if n := cacheQuery(t, c, nil, 1); n != 1 {
+		t.Fatalf("first query = %d; want 1", n)
+	}
+	if n := cacheQuery(t, c, nil, 1); n != 1 {
+		t.Fatalf("second query = %d; want the cached 1", n)
+	}
+	if n := cacheQuery(t, c, nil, 2); n != 2 {
+		t.Fatalf("query with other args = %d; want 2", n)
+	}
+	if got := p.count(); got != 2 {
+		t.Errorf("driver saw %d queries; want 2", got)
+	}
+}
+
+func TestQueryCacheExpiry(t *testing.T) {
+	p := &cacheConnector{}
+	c := NewQueryCache(OpenDB(p), time.Millisecond, 0)
+	cacheQuery(t, c, nil)
+	time.Sleep(5 * time.Millisecond)
+	if n := cacheQuery(t, c, nil); n != 2 {
+		t.Errorf("query after ttl = %d; want a reload", n)
+	}
+}
+
+func TestQueryCacheInvalidate(t *testing.T) {
+	p := &cacheConnector{}
+	c := NewQueryCache(OpenDB(p), time.Minute, 0)
+	cacheQuery(t, c, []string{"users"}, 1)
+	cacheQuery(t, c, []string{"orders"}, 2)
+	c.Invalidate("users")
+	if n := cacheQuery(t, c, []string{"users"}, 1); n != 3 {
+		t.Errorf("invalidated query = %d; want a reload", n)
+	}
+	if n := cacheQuery(t, c, []string{"orders"}, 2); n != 2 {
+		t.Errorf("query with other tag = %d; want the cached 2", n)
+	}
+}
+
+func TestQueryCacheInvalidateDuringLoad(t *testing.T) {
+	p := &cacheConnector{started: make(chan struct{}), block: make(chan struct{})}
+	c := NewQueryCache(OpenDB(p), time.Minute, 0)
+	done := make(chan int64)
+	go func() {
+		done <- cacheQuery(t, c, []string{"users"})
+	}()
+	<-p.started
+	c.Invalidate("users")
+	p.mu.Lock()
+	release := p.block
+	p.block = nil
+	p.mu.Unlock()
+	close(release)
+	if n := <-done; n != 1 {
+		t.Fatalf("in-flight query = %d; want 1", n)
+	}
+	// 加载期间已失效, 结果不能留在缓存中
+	if n := cacheQuery(t, c, []string{"users"}); n != 2 {
+		t.Errorf("query after invalidate = %d; want a reload", n)
+	}
+}
+
+func TestQueryCacheConcurrentLoads(t *testing.T) {
+	p := &cacheConnector{}
+	c := NewQueryCache(OpenDB(p), time.Minute, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if n := cacheQuery(t, c, nil); n < 1 || n > 8 {
+				t.Errorf("query = %d", n)
+			}
+		}()
+	}
+	wg.Wait()
+	before := p.count()
+	cacheQuery(t, c, nil)
+	if p.count() != before {
+		t.Error("query after concurrent loads missed the cache")
+	}
+}
+
+func TestQueryCacheKeyCollision(t *testing.T) {
+	db := OpenDB(&cacheConnector{})
+	k1, err := db.cacheKey("select", []interface{}{"a\x00=string:b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := db.cacheKey("select", []interface{}{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k1 == k2 {
+		t.Errorf("different args produced the same key %q", k1)
+	}
+}
+
+func TestQueryCacheRawBytes(t *testing.T) {
+	c := NewQueryCache(OpenDB(&cacheConnector{}), time.Minute, 0)
+	for i := 0; i < 2; i++ {
+		rows, err := c.QueryContext(context.Background(), nil, "select")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rows.Next() {
+			t.Fatal("no rows")
+		}
+		var n int64
+		var b RawBytes
+		if err := rows.Scan(&n, &b); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "v" {
+			t.Fatalf("pass %d: got %q; want %q", i, b, "v")
+		}
+		// 改写扫描到的RawBytes不能影响缓存
+		b[0] = 'x'
+		rows.Close()
+	}
+}
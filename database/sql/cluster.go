@@ -0,0 +1,155 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Balancer interface {
+	Pick(replicas []*DB) *DB
+}
+
+type RoundRobin struct {
+	next uint64
+}
+func (rr *RoundRobin) Pick(replicas []*DB) *DB {
+	n := atomic.AddUint64(&rr.next, 1)
+	return replicas[(n-1)%uint64(len(replicas))]
+}
+
+// 主库负责写入, 只读请求分发到健康的从库
+type ClusterDB struct {
+	primary *DB
+	replicas []*DB
+	balancer Balancer
+
+	mu sync.RWMutex
+	healthy []*DB
+	stop chan struct{}
+}
+
+func NewClusterDB(primary *DB, replicas []*DB, balancer Balancer) *ClusterDB {
+	if balancer == nil {
+		balancer = &RoundRobin{}
+	}
+	healthy := make([]*DB, len(replicas))
+	copy(healthy, replicas)
+	return &ClusterDB{
+		primary: primary,
+		replicas: replicas,
+		balancer: balancer,
+		healthy: healthy,
+	}
+}
+
+func (c *ClusterDB) Primary() *DB {
+	return c.primary
+}
+
+// Balancer拿到的是健康从库列表的副本, 可以随意修改
+func (c *ClusterDB) Replica() *DB {
+	c.mu.RLock()
+	healthy := make([]*DB, len(c.healthy))
+	copy(healthy, c.healthy)
+	c.mu.RUnlock()
+	if len(healthy) == 0 {
+		return c.primary
+	}
+	return c.balancer.Pick(healthy)
+}
+
+// 写操作总是发往主库
+func (c *ClusterDB) ExecContext(ctx context.Context, query string, args ...interface{}) (driver.Result, error) {
+	return c.Primary().ExecContext(ctx, query, args...)
+}
+
+// 查询发往健康的从库, 没有健康的从库时发往主库
+func (c *ClusterDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	return c.Replica().QueryContext(ctx, query, args...)
+}
+
+func (c *ClusterDB) BeginTx(ctx context.Context, opts *TxOptions) (*Tx, error) {
+	if opts != nil && opts.ReadOnly {
+		return c.Replica().BeginTx(ctx, opts)
+	}
+	return c.primary.BeginTx(ctx, opts)
+}
+
+func (c *ClusterDB) ExecBatch(ctx context.Context, query string, rows [][]interface{}) (driver.Result, error) {
+	return c.primary.ExecBatch(ctx, query, rows)
+}
+
+func (c *ClusterDB) RunInTx(ctx context.Context, opts *TxOptions, fn func(*Tx) error) error {
+	if opts != nil && opts.ReadOnly {
+		return c.Replica().RunInTx(ctx, opts, fn)
+	}
+	return c.primary.RunInTx(ctx, opts, fn)
+}
+
+// 并发地ping所有从库, 一个从库没有响应不会占用其他从库的超时时间
+func (c *ClusterDB) CheckHealth(ctx context.Context) {
+	ok := make([]bool, len(c.replicas))
+	var wg sync.WaitGroup
+	for i, db := range c.replicas {
+		wg.Add(1)
+		go func(i int, db *DB) {
+			defer wg.Done()
+			ok[i] = db.PingContext(ctx) == nil
+		}(i, db)
+	}
+	wg.Wait()
+	healthy := make([]*DB, 0, len(c.replicas))
+	for i, db := range c.replicas {
+		if ok[i] {
+			healthy = append(healthy, db)
+		}
+	}
+	c.mu.Lock()
+	c.healthy = healthy
+	c.mu.Unlock()
+}
+
+var errHealthCheckInterval = errors.New("sql: health check interval must be positive")
+
+// 每隔interval检查一次从库, 每个从库的ping超时为timeout, timeout <= 0 表示不设超时
+func (c *ClusterDB) StartHealthChecks(interval, timeout time.Duration) error {
+	if interval <= 0 {
+		return errHealthCheckInterval
+	}
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	c.mu.Unlock()
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				ctx, cancel := withDefaultTimeout(context.Background(), timeout)
+				c.CheckHealth(ctx)
+				cancel()
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *ClusterDB) StopHealthChecks() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
@@ -0,0 +1,150 @@
+package sql
+
+import (
+	"context"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 同一个节点的所有连接共享状态; down时Ping失败, hang时Ping一直阻塞到ctx结束
+type clusterNode struct {
+	mu sync.Mutex
+	down bool
+	hang bool
+	execs int
+}
+
+func (n *clusterNode) set(down, hang bool) {
+	n.mu.Lock()
+	n.down, n.hang = down, hang
+	n.mu.Unlock()
+}
+
+func (n *clusterNode) Connect(context.Context) (driver.Conn, error) { return &clusterConn{n}, nil }
+func (n *clusterNode) Driver() driver.Driver                        { return nil }
+
+type clusterConn struct {
+	n *clusterNode
+}
+
+func (c *clusterConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *clusterConn) Close() error                        { return nil }
+func (c *clusterConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+func (c *clusterConn) Ping(ctx context.Context) error {
+	c.n.mu.Lock()
+	down, hang := c.n.down, c.n.hang
+	c.n.mu.Unlock()
+	if hang {
+		<-ctx.Done()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if down {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+func (c *clusterConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.n.mu.Lock()
+	c.n.execs++
+	c.n.mu.Unlock()
+	return driver.RowsAffected(1), nil
+}
+
+func newTestCluster(b Balancer) (*ClusterDB, []*clusterNode) {
+	nodes := []*clusterNode{{}, {}, {}}
+	dbs := make([]*DB, len(nodes))
+	for i, n := range nodes {
+		dbs[i] = OpenDB(n)
+	}
+	return NewClusterDB(dbs[0], dbs[1:], b), nodes
+}
+
+func TestClusterRouting(t *testing.T) {
+	c, nodes := newTestCluster(nil)
+	r1, r2 := c.replicas[0], c.replicas[1]
+	for i, want := range []*DB{r1, r2, r1} {
+		if got := c.Replica(); got != want {
+			t.Errorf("Replica() #%d picked the wrong replica", i)
+		}
+	}
+	if _, err := c.ExecContext(context.Background(), "insert"); err != nil {
+		t.Fatal(err)
+	}
+	if nodes[0].execs != 1 || nodes[1].execs != 0 || nodes[2].execs != 0 {
+		t.Errorf("ExecContext went to %d/%d/%d; want the primary", nodes[0].execs, nodes[1].execs, nodes[2].execs)
+	}
+}
+
+// 修改收到的列表, 检查不会影响ClusterDB内部的健康列表
+type scribbleBalancer struct{}
+
+func (scribbleBalancer) Pick(replicas []*DB) *DB {
+	r := replicas[0]
+	replicas[0] = nil
+	return r
+}
+
+func TestClusterBalancerGetsCopy(t *testing.T) {
+	c, _ := newTestCluster(scribbleBalancer{})
+	if c.Replica() == nil || c.Replica() == nil {
+		t.Error("Balancer modified the healthy replica list")
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	c, nodes := newTestCluster(nil)
+	ctx := context.Background()
+	nodes[1].set(true, false)
+	c.CheckHealth(ctx)
+	for i := 0; i < 2; i++ {
+		if c.Replica() != c.replicas[1] {
+			t.Fatal("Replica() picked a replica that failed its health check")
+		}
+	}
+	nodes[2].set(true, false)
+	c.CheckHealth(ctx)
+	if c.Replica() != c.primary {
+		t.Fatal("Replica() did not fall back to the primary with no healthy replicas")
+	}
+	nodes[1].set(false, false)
+	c.CheckHealth(ctx)
+	if c.Replica() != c.replicas[0] {
+		t.Fatal("recovered replica was not used again")
+	}
+}
+
+func TestClusterCheckHealthConcurrent(t *testing.T) {
+	c, nodes := newTestCluster(nil)
+	// 第一个从库没有响应, 不能耗尽第二个从库的超时时间
+	nodes[1].set(false, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c.CheckHealth(ctx)
+	if got := c.Replica(); got != c.replicas[1] {
+		t.Error("responsive replica was marked unhealthy")
+	}
+}
+
+func TestClusterHealthChecks(t *testing.T) {
+	c, nodes := newTestCluster(nil)
+	if err := c.StartHealthChecks(0, time.Second); err == nil {
+		t.Error("StartHealthChecks accepted a zero interval")
+	}
+	nodes[1].set(true, false)
+	nodes[2].set(true, false)
+	if err := c.StartHealthChecks(time.Millisecond, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopHealthChecks()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Replica() != c.primary {
+		if time.Now().After(deadline) {
+			t.Fatal("health checks never marked the replicas unhealthy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,81 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"runtime"
+)
+
+type Conn struct {
+	db *DB
+	ci driver.Conn
+	closed bool
+	leak *leakTrace
+}
+
+var ErrConnDone = errors.New("sql: connection is already closed")
+
+func (db *DB) Conn(ctx context.Context) (*Conn, error) {
+	ci, err := db.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{db: db, ci: ci}
+	if ld := db.leakDetector(); ld != nil {
+		t := ld.track("Conn")
+		c.leak = t
+		runtime.SetFinalizer(c, func(*Conn) { ld.collected(t) })
+	}
+	return c, nil
+}
+
+func (c *Conn) Close() error {
+	return c.close(nil)
+}
+
+// err为ErrBadConn时连接不再放回空闲列表
+func (c *Conn) close(err error) error {
+	if c.closed {
+		return ErrConnDone
+	}
+	c.closed = true
+	c.db.leakDetector().release(c.leak)
+	return c.db.putConn(c.ci, err)
+}
+
+// 驱动未声明时按不支持处理
+func (c *Conn) SupportsTransactionalDDL() bool {
+	if sup, is := c.ci.(driver.TransactionalDDLSupporter); is {
+		return sup.SupportsTransactionalDDL()
+	}
+	return false
+}
+
+func (c *Conn) ExecContext(ctx context.Context, query string, args ...interface{}) (driver.Result, error) {
+	if c.closed {
+		return nil, ErrConnDone
+	}
+	nvargs, err := c.db.driverArgs(c.ci, args)
+	if err != nil {
+		return nil, err
+	}
+	qctx, cancel := c.db.queryContext(ctx)
+	defer cancel()
+	res, err := ctxDriverConnExec(qctx, c.ci, query, nvargs)
+	if isBadConn(err) {
+		c.close(err)
+	}
+	return res, timeoutErr(ctx, qctx, err, ErrQueryTimeout)
+}
+
+func (c *Conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	if c.closed {
+		return nil, ErrConnDone
+	}
+	rows, err := queryConn(ctx, nil, c.db, c.ci, query, args, func(error) {})
+	if isBadConn(err) {
+		c.close(err)
+	}
+	return rows, err
+}
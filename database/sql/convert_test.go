@@ -0,0 +1,132 @@
+package sql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConvertAssign(t *testing.T) {
+	var (
+		s string
+		b []byte
+		i int64
+		f float64
+		ok bool
+		any interface{}
+		raw RawBytes
+	)
+	src := []byte("42")
+	tests := []struct {
+		dest, src, want interface{}
+	}{
+		{&s, "foo", "foo"},
+		{&s, []byte("bar"), "bar"},
+		{&s, int64(-7), "-7"},
+		{&s, 1.5, "1.5"},
+		{&s, true, "true"},
+		{&b, "foo", []byte("foo")},
+		{&i, "42", int64(42)},
+		{&i, []byte("-3"), int64(-3)},
+		{&f, "2.5", 2.5},
+		{&f, int64(3), float64(3)},
+		{&ok, "1", true},
+		{&ok, int64(0), false},
+		{&any, int64(5), int64(5)},
+		{&any, nil, nil},
+		{&raw, src, RawBytes(src)},
+	}
+	for _, tt := range tests {
+		if err := convertAssign(tt.dest, tt.src); err != nil {
+			t.Errorf("convertAssign(%T, %#v): %v", tt.dest, tt.src, err)
+			continue
+		}
+		var got interface{}
+		switch d := tt.dest.(type) {
+		case *string:
+			got = *d
+		case *[]byte:
+			got = string(*d)
+			tt.want = string(tt.want.([]byte))
+		case *int64:
+			got = *d
+		case *float64:
+			got = *d
+		case *bool:
+			got = *d
+		case *interface{}:
+			got = *d
+		case *RawBytes:
+			got = string(*d)
+			tt.want = string(tt.want.(RawBytes))
+		}
+		if got != tt.want {
+			t.Errorf("convertAssign(%T, %#v) = %#v; want %#v", tt.dest, tt.src, got, tt.want)
+		}
+	}
+
+	// 扫描到[]byte时复制数据, 扫描到RawBytes时不复制
+	b = nil
+	convertAssign(&b, src)
+	src[0] = '9'
+	if string(b) != "42" {
+		t.Errorf("*[]byte aliases the source: %q", b)
+	}
+	if string(raw) != "92" {
+		t.Errorf("*RawBytes = %q; want it to alias the source", raw)
+	}
+
+	var tv time.Time
+	now := time.Now()
+	if err := convertAssign(&tv, now); err != nil || !tv.Equal(now) {
+		t.Errorf("time.Time into *time.Time = %v, %v", tv, err)
+	}
+	if err := convertAssign(&i, "x"); err == nil {
+		t.Error("converting \"x\" to int64 succeeded")
+	}
+	if err := convertAssign(&i, nil); err == nil {
+		t.Error("converting NULL to int64 succeeded")
+	}
+}
+
+func TestConvertAssignUint64(t *testing.T) {
+	var u uint64
+	var i int64
+	tests := []struct {
+		dest, src, want interface{}
+	}{
+		{&u, uint64(1 << 63), uint64(1 << 63)},
+		{&u, int64(7), uint64(7)},
+		{&u, []byte("18446744073709551615"), uint64(1<<64 - 1)},
+		{&i, uint64(42), int64(42)},
+	}
+	for _, tt := range tests {
+		if err := convertAssign(tt.dest, tt.src); err != nil {
+			t.Errorf("convertAssign(%T, %#v): %v", tt.dest, tt.src, err)
+			continue
+		}
+		var got interface{}
+		switch d := tt.dest.(type) {
+		case *uint64:
+			got = *d
+		case *int64:
+			got = *d
+		}
+		if got != tt.want {
+			t.Errorf("convertAssign(%T, %#v) = %#v; want %#v", tt.dest, tt.src, got, tt.want)
+		}
+	}
+
+	// 超出目标类型范围的值报错, 不截断
+	overflows := []struct {
+		dest, src interface{}
+	}{
+		{&i, uint64(1 << 63)},
+		{&u, int64(-1)},
+		{&u, []byte("18446744073709551616")},
+	}
+	for _, tt := range overflows {
+		if err := convertAssign(tt.dest, tt.src); err == nil {
+			t.Errorf("convertAssign(%T, %#v) succeeded; want an overflow error", tt.dest, tt.src)
+		}
+	}
+}
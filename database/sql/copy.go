@@ -0,0 +1,326 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"strconv"
+	"strings"
+)
+
+const copyBatchSize = 1000
+
+func (c *Conn) CopyFrom(ctx context.Context, table string, columns []string, src driver.CopySource) (int64, error) {
+	if c.closed {
+		return 0, ErrConnDone
+	}
+	n, err := ctxDriverCopyFrom(ctx, c.ci, table, columns, src)
+	if isBadConn(err) {
+		c.close(err)
+	}
+	return n, err
+}
+
+// 驱动未实现CopyFrom时, 在一个事务中逐批插入, 任何一行失败都回滚已插入的全部数据
+func ctxDriverCopyFrom(ctx context.Context, ci driver.Conn, table string,
+		columns []string, src driver.CopySource) (int64, error) {
+	if cf, is := ci.(driver.CopyFrom); is {
+		return cf.CopyFrom(ctx, table, columns, src)
+	}
+	query := copyInsertQuery(ci, table, columns)
+	txi, err := ctxDriverBegin(ctx, nil, ci)
+	if err != nil {
+		return 0, err
+	}
+	n, err := copyRows(ctx, ci, query, len(columns), src)
+	if err != nil {
+		txi.Rollback()
+		return 0, err
+	}
+	if err := txi.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// 驱动实现了Batcher时每copyBatchSize行执行一次, 否则预编译一次后逐行执行
+func copyRows(ctx context.Context, ci driver.Conn, query string,
+		ncol int, src driver.CopySource) (int64, error) {
+	batcher, _ := ci.(driver.Batcher)
+	var si driver.Stmt
+	if batcher == nil {
+		var err error
+		si, err = ctxDriverPrepare(ctx, ci, query)
+		if err != nil {
+			return 0, err
+		}
+		defer si.Close()
+	}
+	var total int64
+	// 之前各批的源数据行数, 用于把批内的出错位置换算为源数据中的行号
+	offset := 0
+	batch := make([][]driver.NamedValue, 0, copyBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if batcher != nil {
+			res, err := batcher.ExecBatch(ctx, query, batch)
+			if err != nil {
+				if be, ok := err.(*driver.BatchError); ok {
+					return &BatchError{Index: offset + be.Index, Err: be.Err}
+				}
+				return &BatchError{Index: -1, Err: err}
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			total += n
+		} else {
+			for i, nvargs := range batch {
+				res, err := ctxDriverStmtExec(ctx, ci, si, nvargs)
+				if err == nil {
+					var n int64
+					n, err = res.RowsAffected()
+					total += n
+				}
+				if err != nil {
+					return &BatchError{Index: offset + i, Err: err}
+				}
+			}
+		}
+		offset += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		dest := make([]driver.Value, ncol)
+		err := src.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		nvargs := make([]driver.NamedValue, len(dest))
+		for n, v := range dest {
+			nvargs[n] = driver.NamedValue{Ordinal: n + 1, Value: v}
+		}
+		batch = append(batch, nvargs)
+		if len(batch) == copyBatchSize {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// 标识符和占位符由驱动的Dialect决定, 表名中以.分隔的每一部分分别引用
+func copyInsertQuery(ci driver.Conn, table string, columns []string) string {
+	quote, placeholder := quoteIdentifier, func(int) string { return "?" }
+	if d, ok := ci.(driver.Dialect); ok {
+		quote, placeholder = d.QuoteIdentifier, d.Placeholder
+	}
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	for i, part := range strings.Split(table, ".") {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(quote(part))
+	}
+	b.WriteString(" (")
+	for i, col := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quote(col))
+	}
+	b.WriteString(") VALUES (")
+	for i := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(placeholder(i + 1))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// 标准SQL的引用方式: 加上双引号, 其中的双引号写为两个
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// 按行读取以分隔符分隔的文本数据, 格式与COPY FROM STDIN的text格式一致:
+// 字段中的反斜杠转义(\b \f \n \r \t \v \\, 八进制\ooo, 十六进制\xhh, 反斜杠加分隔符)会被解码,
+// 与Null完全相同的未解码字段为NULL, 内容为\.的行表示数据结束
+type CopyReader struct {
+	r io.Reader
+	Delim byte
+	Null string
+	// buf[off:]是尚未返回的数据, buf[off:scan]中已确认没有换行符
+	buf []byte
+	off int
+	scan int
+	eof bool
+}
+
+func NewCopyReader(r io.Reader) *CopyReader {
+	return &CopyReader{r: r, Delim: '\t', Null: `\N`}
+}
+
+func (cr *CopyReader) Next(dest []driver.Value) error {
+	line, err := cr.readLine()
+	if err != nil {
+		return err
+	}
+	if string(line) == `\.` {
+		cr.buf, cr.off, cr.scan, cr.eof = nil, 0, 0, true
+		return io.EOF
+	}
+	fields := splitCopyLine(line, cr.Delim)
+	if len(fields) != len(dest) {
+		return errors.New("sql: copy row has " + strconv.Itoa(len(fields)) + " fields, want " + strconv.Itoa(len(dest)))
+	}
+	for i, f := range fields {
+		if string(f) == cr.Null {
+			dest[i] = nil
+			continue
+		}
+		dest[i] = unescapeCopyField(f)
+	}
+	return nil
+}
+
+// 按分隔符切分一行, 反斜杠之后的字符不作为分隔符
+func splitCopyLine(line []byte, delim byte) [][]byte {
+	var fields [][]byte
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case delim:
+			fields = append(fields, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, line[start:])
+}
+
+func unescapeCopyField(f []byte) string {
+	if bytes.IndexByte(f, '\\') < 0 {
+		return string(f)
+	}
+	b := make([]byte, 0, len(f))
+	for i := 0; i < len(f); i++ {
+		c := f[i]
+		if c != '\\' || i+1 == len(f) {
+			b = append(b, c)
+			continue
+		}
+		i++
+		switch c = f[i]; c {
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'v':
+			b = append(b, '\v')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			v := c - '0'
+			for j := 0; j < 2 && i+1 < len(f) && f[i+1] >= '0' && f[i+1] <= '7'; j++ {
+				i++
+				v = v<<3 | (f[i] - '0')
+			}
+			b = append(b, v)
+		case 'x':
+			var v byte
+			j := 0
+			for ; j < 2 && i+1 < len(f); j++ {
+				d, ok := unhex(f[i+1])
+				if !ok {
+					break
+				}
+				v = v<<4 | d
+				i++
+			}
+			if j == 0 {
+				b = append(b, 'x')
+				continue
+			}
+			b = append(b, v)
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+const copyReadSize = 4096
+
+// 返回的行指向buf, 在下一次调用前有效
+func (cr *CopyReader) readLine() ([]byte, error) {
+	for {
+		if i := bytes.IndexByte(cr.buf[cr.scan:], '\n'); i >= 0 {
+			end := cr.scan + i
+			line := cr.buf[cr.off:end]
+			cr.off, cr.scan = end+1, end+1
+			return bytes.TrimSuffix(line, []byte{'\r'}), nil
+		}
+		cr.scan = len(cr.buf)
+		if cr.eof {
+			if cr.off == len(cr.buf) {
+				return nil, io.EOF
+			}
+			line := cr.buf[cr.off:]
+			cr.off = len(cr.buf)
+			return line, nil
+		}
+		// 丢弃已返回的行, 剩余数据移到开头, 空间不足时才扩容
+		if cr.off > 0 {
+			n := copy(cr.buf, cr.buf[cr.off:])
+			cr.buf = cr.buf[:n]
+			cr.scan -= cr.off
+			cr.off = 0
+		}
+		if cap(cr.buf)-len(cr.buf) < copyReadSize {
+			buf := make([]byte, len(cr.buf), 2*cap(cr.buf)+copyReadSize)
+			copy(buf, cr.buf)
+			cr.buf = buf
+		}
+		n, err := cr.r.Read(cr.buf[len(cr.buf):cap(cr.buf)])
+		cr.buf = cr.buf[:len(cr.buf)+n]
+		if err == io.EOF {
+			cr.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
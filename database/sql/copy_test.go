@@ -0,0 +1,191 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type copySource struct {
+	s string
+}
+
+func (r *copySource) Read(p []byte) (int, error) {
+	if len(r.s) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.s)
+	r.s = r.s[n:]
+	return n, nil
+}
+
+func TestCopyReaderEscapes(t *testing.T) {
+	cr := NewCopyReader(&copySource{"a\\tb\tline\\nbreak\n\\\\N\t\\N\n\\101\\x42\\q\t\\\t\n\\.\nignored\n"})
+	want := [][]driver.Value{
+		{"a\tb", "line\nbreak"},
+		{`\N`, nil},
+		{"ABq", "\t"},
+	}
+	for i, w := range want {
+		dest := make([]driver.Value, 2)
+		if err := cr.Next(dest); err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(dest, w) {
+			t.Errorf("row %d = %q; want %q", i, dest, w)
+		}
+	}
+	if err := cr.Next(make([]driver.Value, 2)); err != io.EOF {
+		t.Errorf("Next after end marker = %v; want io.EOF", err)
+	}
+}
+
+// 每次只返回1字节, 一行数据需要多次读取才能拼完
+type oneByteReader struct {
+	s string
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(r.s) == 0 {
+		return 0, io.EOF
+	}
+	p[0] = r.s[0]
+	r.s = r.s[1:]
+	return 1, nil
+}
+
+func TestCopyReaderShortReads(t *testing.T) {
+	long := strings.Repeat("x", 3*copyReadSize)
+	cr := NewCopyReader(&oneByteReader{"a\tb\r\n" + long + "\tc\nlast\td"})
+	want := [][]driver.Value{{"a", "b"}, {long, "c"}, {"last", "d"}}
+	for i, w := range want {
+		dest := make([]driver.Value, 2)
+		if err := cr.Next(dest); err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(dest, w) {
+			t.Errorf("row %d = %.20q; want %.20q", i, dest, w)
+		}
+	}
+	if err := cr.Next(make([]driver.Value, 2)); err != io.EOF {
+		t.Errorf("Next at end = %v; want io.EOF", err)
+	}
+}
+
+func TestCopyInsertQuery(t *testing.T) {
+	got := copyInsertQuery(copyConn{}, "s.t", []string{"a", `b"c`})
+	want := `INSERT INTO "s"."t" ("a", "b""c") VALUES (?, ?)`
+	if got != want {
+		t.Errorf("copyInsertQuery = %s; want %s", got, want)
+	}
+	got = copyInsertQuery(&copyStmtConn{}, "t", []string{"a", "b"})
+	want = "INSERT INTO `t` (`a`, `b`) VALUES ($1, $2)"
+	if got != want {
+		t.Errorf("copyInsertQuery with Dialect = %s; want %s", got, want)
+	}
+}
+
+type copyTx struct {
+	committed, rolledBack *bool
+}
+
+func (tx copyTx) Commit() error {
+	*tx.committed = true
+	return nil
+}
+func (tx copyTx) Rollback() error {
+	*tx.rolledBack = true
+	return nil
+}
+
+// 每行都返回0行受影响, 值为"bad"的行执行失败
+type copyConn struct {
+	driver.Conn
+	committed, rolledBack *bool
+}
+
+func (c copyConn) Begin() (driver.Tx, error) {
+	return copyTx{c.committed, c.rolledBack}, nil
+}
+
+func (copyConn) ExecBatch(ctx context.Context, query string, rows [][]driver.NamedValue) (driver.Result, error) {
+	for i, row := range rows {
+		if row[0].Value == "bad" {
+			return nil, &driver.BatchError{Index: i, Err: errors.New("bad row")}
+		}
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func TestCopyFromBatchErrorIndex(t *testing.T) {
+	var src string
+	for i := 0; i < copyBatchSize+2; i++ {
+		src += "ok\n"
+	}
+	src += "bad\n"
+	var committed, rolledBack bool
+	ci := copyConn{committed: &committed, rolledBack: &rolledBack}
+	n, err := ctxDriverCopyFrom(context.Background(), ci, "t", []string{"a"}, NewCopyReader(&copySource{src}))
+	be, ok := err.(*BatchError)
+	if !ok || be.Index != copyBatchSize+2 {
+		t.Fatalf("err = %v; want BatchError at index %d", err, copyBatchSize+2)
+	}
+	// 第一批已经执行过, 但整个导入在同一个事务中, 失败时全部回滚
+	if n != 0 || committed || !rolledBack {
+		t.Errorf("n = %d, committed = %v, rolledBack = %v; want the whole copy rolled back", n, committed, rolledBack)
+	}
+}
+
+// 不支持Batcher的连接, 使用自己的Dialect, 记录预编译次数和执行的参数
+type copyStmtConn struct {
+	driver.Conn
+	committed, rolledBack bool
+	prepares []string
+	rows []driver.Value
+}
+
+func (c *copyStmtConn) QuoteIdentifier(name string) string { return "`" + name + "`" }
+func (c *copyStmtConn) Placeholder(n int) string          { return "$" + strconv.Itoa(n) }
+func (c *copyStmtConn) Begin() (driver.Tx, error) {
+	return copyTx{&c.committed, &c.rolledBack}, nil
+}
+func (c *copyStmtConn) Prepare(query string) (driver.Stmt, error) {
+	c.prepares = append(c.prepares, query)
+	return copyStmt{c}, nil
+}
+
+type copyStmt struct {
+	c *copyStmtConn
+}
+
+func (s copyStmt) Close() error  { return nil }
+func (s copyStmt) NumInput() int { return -1 }
+func (s copyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.c.rows = append(s.c.rows, args[0])
+	return driver.RowsAffected(1), nil
+}
+func (s copyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestCopyFromPreparedFallback(t *testing.T) {
+	ci := &copyStmtConn{}
+	n, err := ctxDriverCopyFrom(context.Background(), ci, "t", []string{"a"}, NewCopyReader(&copySource{"x\n\\N\ny\n"}))
+	if err != nil || n != 3 {
+		t.Fatalf("CopyFrom = %d, %v; want 3 rows", n, err)
+	}
+	if len(ci.prepares) != 1 || ci.prepares[0] != "INSERT INTO `t` (`a`) VALUES ($1)" {
+		t.Errorf("prepares = %q; want the insert prepared once", ci.prepares)
+	}
+	if want := []driver.Value{"x", nil, "y"}; !reflect.DeepEqual(ci.rows, want) {
+		t.Errorf("rows = %v; want %v", ci.rows, want)
+	}
+	if !ci.committed || ci.rolledBack {
+		t.Errorf("committed = %v, rolledBack = %v; want committed", ci.committed, ci.rolledBack)
+	}
+}
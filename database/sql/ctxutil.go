@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/dimdark/gdk/database/sql/driver"
+	"time"
 )
 
 func namedValueToValue(named []driver.NamedValue) ([]driver.Value, error) {
@@ -17,6 +18,81 @@ func namedValueToValue(named []driver.NamedValue) ([]driver.Value, error) {
 	return dargs, nil
 }
 
+const defaultCancelGracePeriod = 5 * time.Second
+
+type cancelGraceKey struct{}
+
+// 由DB.queryContext附加到语句的ctx上, d <= 0 时使用默认值
+func withCancelGrace(ctx context.Context, d time.Duration) context.Context {
+	if d <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, cancelGraceKey{}, d)
+}
+
+func cancelGrace(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(cancelGraceKey{}).(time.Duration); ok {
+		return d
+	}
+	return defaultCancelGracePeriod
+}
+
+// 被放弃的旧接口调用, 按driver.ErrBadConn处理; 调用最终返回时done被关闭
+type abandonedCallError struct {
+	done chan struct{}
+}
+func (e *abandonedCallError) Error() string {
+	return driver.ErrBadConn.Error()
+}
+func (e *abandonedCallError) Unwrap() error {
+	return driver.ErrBadConn
+}
+
+func abandonedCall(err error) (*abandonedCallError, bool) {
+	if be, ok := err.(*BatchError); ok {
+		err = be.Err
+	}
+	ae, ok := err.(*abandonedCallError)
+	return ae, ok
+}
+
+// 旧接口的驱动调用不接受ctx, ctx结束时通过连接实现的driver.Canceler取消正在执行的调用,
+// 若驱动在宽限期(见DB.SetCancelGracePeriod)内仍未返回则放弃该调用并返回*abandonedCallError,
+// 被放弃的调用仍在使用连接, putConn等到调用返回后才关闭连接
+func watchLegacyCall(ctx context.Context, c interface{}, call func() error) error {
+	if ctx.Done() == nil {
+		return call()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	if canceler, is := c.(driver.Canceler); is {
+		canceler.Cancel()
+	}
+	t := time.NewTimer(cancelGrace(ctx))
+	defer t.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			return ctx.Err()
+		}
+		return nil
+	case <-t.C:
+	}
+	ae := &abandonedCallError{done: make(chan struct{})}
+	go func() {
+		<-done
+		close(ae.done)
+	}()
+	return ae
+}
+
 func ctxDriverPrepare(ctx context.Context, ci driver.Conn, query string) (driver.Stmt, error) {
 	if ciCtx, is := ci.(driver.ConnPrepareContext); is {
 		return ciCtx.PrepareContext(ctx, query)
@@ -47,7 +123,55 @@ func ctxDriverExec(ctx context.Context, execerCtx driver.ExecerContext,
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
-	return execer.Exec(query, dargs)
+	var res driver.Result
+	err = watchLegacyCall(ctx, execer, func() (err error) {
+		res, err = execer.Exec(query, dargs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func ctxDriverConnExec(ctx context.Context, ci driver.Conn, query string,
+		nvdargs []driver.NamedValue) (driver.Result, error) {
+	execerCtx, _ := ci.(driver.ExecerContext)
+	execer, _ := ci.(driver.Execer)
+	if execerCtx != nil || execer != nil {
+		res, err := ctxDriverExec(ctx, execerCtx, execer, query, nvdargs)
+		if err != driver.ErrSkip {
+			return res, err
+		}
+	}
+	si, err := ctxDriverPrepare(ctx, ci, query)
+	if err != nil {
+		return nil, err
+	}
+	defer si.Close()
+	return ctxDriverStmtExec(ctx, ci, si, nvdargs)
+}
+
+func ctxDriverConnQuery(ctx context.Context, ci driver.Conn, query string,
+		nvdargs []driver.NamedValue) (driver.Rows, func(), error) {
+	queryerCtx, _ := ci.(driver.QueryerContext)
+	queryer, _ := ci.(driver.Queryer)
+	if queryerCtx != nil || queryer != nil {
+		rows, err := ctxDriverQuery(ctx, queryerCtx, queryer, query, nvdargs)
+		if err != driver.ErrSkip {
+			return rows, func() {}, err
+		}
+	}
+	si, err := ctxDriverPrepare(ctx, ci, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := ctxDriverStmtQuery(ctx, ci, si, nvdargs)
+	if err != nil {
+		si.Close()
+		return nil, nil, err
+	}
+	return rows, func() { si.Close() }, nil
 }
 
 func ctxDriverQuery(ctx context.Context, queryerCtx driver.QueryerContext,
@@ -64,10 +188,19 @@ func ctxDriverQuery(ctx context.Context, queryerCtx driver.QueryerContext,
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
-	return queryer.Query(query, dargs)
+	var rows driver.Rows
+	err = watchLegacyCall(ctx, queryer, func() (err error) {
+		rows, err = queryer.Query(query, dargs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
 }
 
-func ctxDriverStmtExec(ctx context.Context, si driver.Stmt,
+// 取消操作由连接实现, ci为si所属的连接
+func ctxDriverStmtExec(ctx context.Context, ci driver.Conn, si driver.Stmt,
 		nvdargs []driver.NamedValue) (driver.Result, error) {
 	if siCtx, is := si.(driver.StmtExecContext); is {
 		return siCtx.ExecContext(ctx, nvdargs)
@@ -81,10 +214,18 @@ func ctxDriverStmtExec(ctx context.Context, si driver.Stmt,
 		return nil, ctx.Err()
 	default:
 	}
-	return si.Exec(dargs)
+	var res driver.Result
+	err = watchLegacyCall(ctx, ci, func() (err error) {
+		res, err = si.Exec(dargs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
-func ctxDriverStmtQuery(ctx context.Context, si driver.Stmt,
+func ctxDriverStmtQuery(ctx context.Context, ci driver.Conn, si driver.Stmt,
 		nvdargs []driver.NamedValue) (driver.Rows, error) {
 	if siCtx, is := si.(driver.StmtQueryContext); is {
 		return siCtx.QueryContext(ctx, nvdargs)
@@ -98,13 +239,70 @@ func ctxDriverStmtQuery(ctx context.Context, si driver.Stmt,
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
-	return si.Query(dargs)
+	var rows driver.Rows
+	err = watchLegacyCall(ctx, ci, func() (err error) {
+		rows, err = si.Query(dargs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
 }
 
-var errLevelNotSupported = errors.New("sql: selected isolation level is not supported")
+var ErrLevelNotSupported = errors.New("sql: selected isolation level is not supported")
+
+type levelNotSupportedError struct {
+	level IsolationLevel
+}
+func (e *levelNotSupportedError) Error() string {
+	return ErrLevelNotSupported.Error() + ": " + e.level.String()
+}
+func (e *levelNotSupportedError) Unwrap() error {
+	return ErrLevelNotSupported
+}
+
+// 不支持ConnBeginTx的驱动只支持LevelDefault;
+// 支持ConnBeginTx但未实现IsolationLevelSupporter时返回nil, 表示未知, 交给驱动在BeginTx时判断
+func driverIsolationLevels(ci driver.Conn) []IsolationLevel {
+	if _, is := ci.(driver.ConnBeginTx); !is {
+		return []IsolationLevel{LevelDefault}
+	}
+	sup, is := ci.(driver.IsolationLevelSupporter)
+	if !is {
+		return nil
+	}
+	dlevels := sup.SupportedIsolationLevels()
+	levels := make([]IsolationLevel, len(dlevels))
+	for i, l := range dlevels {
+		levels[i] = IsolationLevel(l)
+	}
+	return levels
+}
+
+func checkIsolationLevel(ci driver.Conn, level IsolationLevel) error {
+	if level == LevelDefault {
+		return nil
+	}
+	levels := driverIsolationLevels(ci)
+	if levels == nil {
+		return nil
+	}
+	for _, l := range levels {
+		if l == level {
+			return nil
+		}
+	}
+	return &levelNotSupportedError{level: level}
+}
 
 func ctxDriverBegin(ctx context.Context, opts *TxOptions,
 		ci driver.Conn) (driver.Tx, error) {
+	if opts != nil {
+		if err := checkIsolationLevel(ci, opts.Isolation); err != nil {
+			return nil, err
+		}
+	}
 	if ciCtx, is :=ci.(driver.ConnBeginTx); is {
 		dopts := driver.TxOptions{}
 		if opts != nil {
@@ -114,9 +312,6 @@ func ctxDriverBegin(ctx context.Context, opts *TxOptions,
 		return ciCtx.BeginTx(ctx, dopts)
 	}
 	if opts != nil {
-		if opts.Isolation != LevelDefault {
-			return nil, errors.New("sql: driver does not support non-default isolation level")
-		}
 		if opts.ReadOnly {
 			return nil, errors.New("sql: driver does not support read-only transactions")
 		}
@@ -136,13 +331,47 @@ func ctxDriverBegin(ctx context.Context, opts *TxOptions,
 	return txi, err
 }
 
-
-
-
-
-
-
-
+func ctxDriverExecBatch(ctx context.Context, ci driver.Conn, query string,
+		nvrows [][]driver.NamedValue) (driver.Result, error) {
+	if batcher, is := ci.(driver.Batcher); is {
+		res, err := batcher.ExecBatch(ctx, query, nvrows)
+		if err != nil {
+			if be, ok := err.(*driver.BatchError); ok {
+				return nil, &BatchError{Index: be.Index, Err: be.Err}
+			}
+			return nil, &BatchError{Index: -1, Err: err}
+		}
+		return res, nil
+	}
+	txi, err := ctxDriverBegin(ctx, nil, ci)
+	if err != nil {
+		return nil, &BatchError{Index: -1, Err: err}
+	}
+	si, err := ctxDriverPrepare(ctx, ci, query)
+	if err != nil {
+		txi.Rollback()
+		return nil, &BatchError{Index: -1, Err: err}
+	}
+	var affected int64
+	for i, nvargs := range nvrows {
+		res, err := ctxDriverStmtExec(ctx, ci, si, nvargs)
+		if err == nil {
+			var n int64
+			n, err = res.RowsAffected()
+			affected += n
+		}
+		if err != nil {
+			si.Close()
+			txi.Rollback()
+			return nil, &BatchError{Index: i, Err: err}
+		}
+	}
+	si.Close()
+	if err := txi.Commit(); err != nil {
+		return nil, &BatchError{Index: -1, Err: err}
+	}
+	return driver.RowsAffected(affected), nil
+}
 
 
 
@@ -0,0 +1,205 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"testing"
+	"time"
+)
+
+// 只支持预处理语句的旧接口驱动, 取消由连接实现
+type cancelConn struct {
+	driver.Conn
+	canceled chan struct{}
+}
+
+func (c *cancelConn) Prepare(query string) (driver.Stmt, error) {
+	return cancelStmt{c}, nil
+}
+
+func (c *cancelConn) Cancel() error {
+	close(c.canceled)
+	return nil
+}
+
+type cancelStmt struct {
+	c *cancelConn
+}
+
+func (s cancelStmt) Close() error  { return nil }
+func (s cancelStmt) NumInput() int { return -1 }
+func (s cancelStmt) Exec(args []driver.Value) (driver.Result, error) {
+	<-s.c.canceled
+	return nil, errors.New("canceled by server")
+}
+func (s cancelStmt) Query(args []driver.Value) (driver.Rows, error) {
+	<-s.c.canceled
+	return nil, errors.New("canceled by server")
+}
+
+func TestStmtCancelUsesConn(t *testing.T) {
+	c := &cancelConn{canceled: make(chan struct{})}
+	ctx, cancel := context.WithCancel(withCancelGrace(context.Background(), time.Second))
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := ctxDriverConnExec(ctx, c, "q", nil); err != context.Canceled {
+		t.Errorf("Exec err = %v; want context.Canceled", err)
+	}
+	c = &cancelConn{canceled: make(chan struct{})}
+	ctx, cancel = context.WithCancel(withCancelGrace(context.Background(), time.Second))
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, _, err := ctxDriverConnQuery(ctx, c, "q", nil); err != context.Canceled {
+		t.Errorf("Query err = %v; want context.Canceled", err)
+	}
+}
+
+// 只有Begin的旧接口连接
+type levelConn struct {
+	driver.Conn
+	begins int
+}
+
+func (c *levelConn) Begin() (driver.Tx, error) {
+	c.begins++
+	return c, nil
+}
+func (c *levelConn) Close() error    { return nil }
+func (c *levelConn) Commit() error   { return nil }
+func (c *levelConn) Rollback() error { return nil }
+
+// 支持BeginTx, 记录收到的隔离级别
+type levelCtxConn struct {
+	levelConn
+	got []driver.IsolationLevel
+}
+
+func (c *levelCtxConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.got = append(c.got, opts.Isolation)
+	return c, nil
+}
+
+// 声明只支持READ COMMITTED
+type levelListConn struct {
+	levelCtxConn
+}
+
+func (c *levelListConn) SupportedIsolationLevels() []driver.IsolationLevel {
+	return []driver.IsolationLevel{driver.IsolationLevel(LevelReadCommitted)}
+}
+
+type levelConnector struct {
+	c driver.Conn
+}
+
+func (p levelConnector) Connect(context.Context) (driver.Conn, error) { return p.c, nil }
+func (p levelConnector) Driver() driver.Driver                        { return nil }
+
+func isLevelNotSupported(err error) bool {
+	u, ok := err.(interface{ Unwrap() error })
+	return ok && u.Unwrap() == ErrLevelNotSupported
+}
+
+func TestIsolationLevels(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		c driver.Conn
+		levels []IsolationLevel
+		ok map[IsolationLevel]bool
+	}{
+		{"legacy", &levelConn{}, []IsolationLevel{LevelDefault},
+			map[IsolationLevel]bool{LevelDefault: true, LevelSerializable: false}},
+		// 未声明时返回nil, 任何级别都交给驱动判断
+		{"unknown", &levelCtxConn{}, nil,
+			map[IsolationLevel]bool{LevelDefault: true, LevelSerializable: true}},
+		{"declared", &levelListConn{}, []IsolationLevel{LevelReadCommitted},
+			map[IsolationLevel]bool{LevelDefault: true, LevelReadCommitted: true, LevelSerializable: false}},
+	}
+	for _, tt := range tests {
+		db := OpenDB(levelConnector{tt.c})
+		levels, err := db.SupportedIsolationLevels(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(levels) != len(tt.levels) || (levels == nil) != (tt.levels == nil) {
+			t.Errorf("%s: SupportedIsolationLevels = %v; want %v", tt.name, levels, tt.levels)
+		} else {
+			for i := range levels {
+				if levels[i] != tt.levels[i] {
+					t.Errorf("%s: SupportedIsolationLevels = %v; want %v", tt.name, levels, tt.levels)
+				}
+			}
+		}
+		for level, ok := range tt.ok {
+			tx, err := db.BeginTx(ctx, &TxOptions{Isolation: level})
+			if ok {
+				if err != nil {
+					t.Errorf("%s: BeginTx(%v) = %v", tt.name, level, err)
+					continue
+				}
+				tx.Rollback()
+			} else if !isLevelNotSupported(err) {
+				t.Errorf("%s: BeginTx(%v) = %v; want ErrLevelNotSupported", tt.name, level, err)
+			}
+		}
+	}
+}
+
+// 不响应取消的旧接口连接, Exec一直阻塞到release被关闭; 记录Close时Exec是否仍在执行
+type hungConn struct {
+	driver.Conn
+	release chan struct{}
+	running chan struct{}
+	closed chan bool
+}
+
+func (c *hungConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	close(c.running)
+	<-c.release
+	c.running = nil
+	return driver.RowsAffected(0), nil
+}
+func (c *hungConn) Close() error {
+	c.closed <- c.running != nil
+	return nil
+}
+
+type hungConnector struct {
+	c *hungConn
+}
+
+func (p hungConnector) Connect(context.Context) (driver.Conn, error) { return p.c, nil }
+func (p hungConnector) Driver() driver.Driver                        { return nil }
+
+func TestAbandonedCallClosesAfterReturn(t *testing.T) {
+	c := &hungConn{release: make(chan struct{}), running: make(chan struct{}), closed: make(chan bool, 1)}
+	db := OpenDB(hungConnector{c})
+	db.SetCancelGracePeriod(10 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-c.running
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := db.ExecContext(ctx, "q"); !isBadConn(err) {
+		t.Fatalf("ExecContext err = %v; want driver.ErrBadConn", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("ExecContext waited %v; want the configured grace period", d)
+	}
+	// 驱动调用返回前不能关闭连接
+	select {
+	case <-c.closed:
+		t.Fatal("connection closed while the abandoned call was still running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(c.release)
+	select {
+	case running := <-c.closed:
+		if running {
+			t.Error("connection closed while the abandoned call was still running")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection never closed after the abandoned call returned")
+	}
+}
@@ -0,0 +1,139 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// 将切片参数编码为驱动接受的值, elems中的每个元素已经过参数转换
+type ArrayEncoder interface {
+	EncodeArray(elems []Value) (Value, error)
+}
+
+var (
+	// 编码为PostgreSQL数组字面量, 如 {1,2,NULL}
+	PostgresArray ArrayEncoder = postgresArray{}
+	// 编码为JSON数组
+	JSONArray ArrayEncoder = jsonArray{}
+	// 原样以[]Value交给驱动
+	NativeArray ArrayEncoder = nativeArray{}
+)
+
+func (c defaultConverter) convertArray(rv reflect.Value) (Value, error) {
+	elems := make([]Value, rv.Len())
+	for i := range elems {
+		v := rv.Index(i).Interface()
+		if isNestedArray(v) {
+			return nil, fmt.Errorf("array element %d: nested arrays are not supported", i)
+		}
+		ev, err := c.convertArrayElem(v)
+		if err != nil {
+			return nil, fmt.Errorf("array element %d: %v", i, err)
+		}
+		elems[i] = ev
+	}
+	return c.native.Arrays.EncodeArray(elems)
+}
+
+// [N]byte类型的元素(如UUID)按[]byte处理, 除非它实现了Valuer或注册为原生类型
+func (c defaultConverter) convertArrayElem(v interface{}) (Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 && !c.native.IsValue(v) {
+		if _, ok := v.(Valuer); !ok {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return b, nil
+		}
+	}
+	return c.ConvertValue(v)
+}
+
+// 元素本身是切片或数组([]byte和[N]byte除外), 编码后会被当作普通的值
+func isNestedArray(v interface{}) bool {
+	if _, ok := v.(Valuer); ok {
+		return false
+	}
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return t.Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+type postgresArray struct{}
+func (postgresArray) EncodeArray(elems []Value) (Value, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range elems {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		switch v := e.(type) {
+		case nil:
+			b.WriteString("NULL")
+		case int64:
+			b.WriteString(strconv.FormatInt(v, 10))
+		case uint64:
+			b.WriteString(strconv.FormatUint(v, 10))
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		case bool:
+			if v {
+				b.WriteByte('t')
+			} else {
+				b.WriteByte('f')
+			}
+		case string:
+			appendPostgresQuoted(&b, v)
+		case []byte:
+			appendPostgresQuoted(&b, `\x`+hex.EncodeToString(v))
+		case time.Time:
+			appendPostgresQuoted(&b, v.Format(time.RFC3339Nano))
+		default:
+			return nil, fmt.Errorf("unsupported array element type %T", e)
+		}
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
+
+func appendPostgresQuoted(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+}
+
+type jsonArray struct{}
+func (jsonArray) EncodeArray(elems []Value) (Value, error) {
+	vs := make([]interface{}, len(elems))
+	for i, e := range elems {
+		if t, ok := e.(time.Time); ok {
+			vs[i] = t.Format(time.RFC3339Nano)
+			continue
+		}
+		vs[i] = e
+	}
+	return json.Marshal(vs)
+}
+
+type nativeArray struct{}
+func (nativeArray) EncodeArray(elems []Value) (Value, error) {
+	return elems, nil
+}
@@ -4,8 +4,14 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"strconv"
 )
 
+var ErrBadConn = errors.New("driver: bad connection")
+
+// Execer, Queryer等可选接口的实现返回ErrSkip时, sql包改为走预处理语句的路径
+var ErrSkip = errors.New("driver: skip fast-path; continue as if unimplemented")
+
 type Value interface{}
 
 type NamedValue struct {
@@ -35,6 +41,24 @@ type Execer interface {
 type ExecerContext interface {
 	ExecContext(ctx context.Context, query string, args []NamedValue) (Result, error)
 }
+type Batcher interface {
+	ExecBatch(ctx context.Context, query string, args [][]NamedValue) (Result, error)
+}
+type BatchError struct {
+	Index int
+	Err error
+}
+func (e *BatchError) Error() string {
+	return "sql/driver: batch row " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+type CopySource interface {
+	Next(dest []Value) error
+}
+type CopyFrom interface {
+	CopyFrom(ctx context.Context, table string, columns []string, src CopySource) (int64, error)
+}
+
 type Queryer interface {
 	Query(query string, args []Value) (Rows, error)
 }
@@ -60,6 +84,32 @@ type TxOptions struct {
 type ConnBeginTx interface {
 	BeginTx(ctx context.Context, opts TxOptions) (Tx, error)
 }
+type IsolationLevelSupporter interface {
+	SupportedIsolationLevels() []IsolationLevel
+}
+type Uint64Supporter interface {
+	SupportsUint64() bool
+}
+type TransactionalDDLSupporter interface {
+	SupportsTransactionalDDL() bool
+}
+
+// 由驱动决定拼接SQL时标识符的引用方式和第n个(从1开始)参数的占位符,
+// 未实现时使用标准SQL的双引号和?
+type Dialect interface {
+	QuoteIdentifier(name string) string
+	Placeholder(n int) string
+}
+
+type Savepointer interface {
+	Savepoint(ctx context.Context, name string) error
+	RollbackTo(ctx context.Context, name string) error
+	Release(ctx context.Context, name string) error
+}
+
+type Canceler interface {
+	Cancel() error
+}
 
 type SessionResetter interface {
 	ResetSession(ctx context.Context) error
@@ -128,6 +178,20 @@ type Tx interface {
 	Rollback() error
 }
 
+type Error interface {
+	error
+	SQLState() string
+	Severity() string
+	Constraint() string
+	Table() string
+	Column() string
+}
+
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
 type Result interface {
 	LastInsertId() (int64, error)
 	RowsAffected() (int64, error)
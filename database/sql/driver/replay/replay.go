@@ -0,0 +1,830 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	opPrepare = "prepare"
+	opExec = "exec"
+	opQuery = "query"
+	opBegin = "begin"
+	opCommit = "commit"
+	opRollback = "rollback"
+	// 录制文件的第一条记录, 保存被包装连接声明的能力
+	opHeader = "header"
+)
+
+// 录制文件中的一条记录, 每行一个JSON对象
+type entry struct {
+	Op string `json:"op"`
+	Query string `json:"query,omitempty"`
+	Args []value `json:"args,omitempty"`
+	Columns []string `json:"columns,omitempty"`
+	Rows [][]value `json:"rows,omitempty"`
+	LastInsertId int64 `json:"last_insert_id,omitempty"`
+	RowsAffected int64 `json:"rows_affected,omitempty"`
+	Isolation int `json:"isolation,omitempty"`
+	ReadOnly bool `json:"read_only,omitempty"`
+	Err string `json:"err,omitempty"`
+	BadConn bool `json:"bad_conn,omitempty"`
+	State *errState `json:"state,omitempty"`
+	Uint64 bool `json:"uint64,omitempty"`
+	ValueTypes bool `json:"value_types,omitempty"`
+	TransactionalDDL bool `json:"transactional_ddl,omitempty"`
+}
+
+// driver.Error中的结构化信息
+type errState struct {
+	SQLState string `json:"sqlstate"`
+	Severity string `json:"severity,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
+	Table string `json:"table,omitempty"`
+	Column string `json:"column,omitempty"`
+}
+
+type value struct {
+	N string `json:"n,omitempty"`
+	T string `json:"t"`
+	I int64 `json:"i,omitempty"`
+	F float64 `json:"f,omitempty"`
+	B bool `json:"b,omitempty"`
+	S string `json:"s,omitempty"`
+	Bytes []byte `json:"bytes,omitempty"`
+	Time *time.Time `json:"time,omitempty"`
+}
+
+func encodeValue(v driver.Value) value {
+	switch v := v.(type) {
+	case nil:
+		return value{T: "null"}
+	case int64:
+		return value{T: "int64", I: v}
+	case uint64:
+		return value{T: "uint64", S: strconv.FormatUint(v, 10)}
+	case float64:
+		// JSON无法表示NaN和±Inf, 以字符串形式保存
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return value{T: "float64", S: strconv.FormatFloat(v, 'g', -1, 64)}
+		}
+		return value{T: "float64", F: v}
+	case bool:
+		return value{T: "bool", B: v}
+	case string:
+		return value{T: "string", S: v}
+	case []byte:
+		return value{T: "bytes", Bytes: v}
+	case time.Time:
+		return value{T: "time", Time: &v}
+	}
+	return value{T: "string", S: fmt.Sprint(v)}
+}
+
+func (v value) decode() (driver.Value, error) {
+	switch v.T {
+	case "int64":
+		return v.I, nil
+	case "uint64":
+		u, err := strconv.ParseUint(v.S, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("replay: bad uint64 value %q", v.S)
+		}
+		return u, nil
+	case "float64":
+		if v.S != "" {
+			f, err := strconv.ParseFloat(v.S, 64)
+			if err != nil {
+				return nil, fmt.Errorf("replay: bad float64 value %q", v.S)
+			}
+			return f, nil
+		}
+		return v.F, nil
+	case "bool":
+		return v.B, nil
+	case "string":
+		return v.S, nil
+	case "bytes":
+		if v.Bytes == nil {
+			return []byte{}, nil
+		}
+		return v.Bytes, nil
+	case "time":
+		if v.Time == nil {
+			return time.Time{}, nil
+		}
+		return *v.Time, nil
+	case "null":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("replay: unknown value type %q", v.T)
+}
+
+func encodeArgs(args []driver.NamedValue) []value {
+	if len(args) == 0 {
+		return nil
+	}
+	vs := make([]value, len(args))
+	for i, a := range args {
+		vs[i] = encodeValue(a.Value)
+		vs[i].N = a.Name
+	}
+	return vs
+}
+
+func encodeRow(row []driver.Value) []value {
+	vs := make([]value, len(row))
+	for i, v := range row {
+		vs[i] = encodeValue(v)
+	}
+	return vs
+}
+
+func namedArgs(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nv
+}
+
+var errNamedArgs = errors.New("sql: driver does not support the use of Named Parameters")
+
+func positionalArgs(args []driver.NamedValue) ([]driver.Value, error) {
+	vs := make([]driver.Value, len(args))
+	for i, a := range args {
+		if a.Name != "" {
+			return nil, errNamedArgs
+		}
+		vs[i] = a.Value
+	}
+	return vs, nil
+}
+
+// 记录错误信息; ErrBadConn和driver.Error的结构化信息也一并保存, 回放时还原
+func (e *entry) setErr(err error) *entry {
+	if err == nil {
+		return e
+	}
+	e.Err = err.Error()
+	for err != nil {
+		if err == driver.ErrBadConn {
+			e.BadConn = true
+			return e
+		}
+		if de, ok := err.(driver.Error); ok {
+			e.State = &errState{
+				SQLState: de.SQLState(),
+				Severity: de.Severity(),
+				Constraint: de.Constraint(),
+				Table: de.Table(),
+				Column: de.Column(),
+			}
+			return e
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return e
+}
+
+func (e *entry) error() error {
+	switch {
+	case e.Err == "":
+		return nil
+	case e.BadConn:
+		return driver.ErrBadConn
+	case e.State != nil:
+		return &replayError{msg: e.Err, state: *e.State}
+	}
+	return errors.New(e.Err)
+}
+
+// 回放录制时驱动返回的driver.Error
+type replayError struct {
+	msg string
+	state errState
+}
+
+var _ driver.Error = (*replayError)(nil)
+
+func (e *replayError) Error() string      { return e.msg }
+func (e *replayError) SQLState() string   { return e.state.SQLState }
+func (e *replayError) Severity() string   { return e.state.Severity }
+func (e *replayError) Constraint() string { return e.state.Constraint }
+func (e *replayError) Table() string      { return e.state.Table }
+func (e *replayError) Column() string     { return e.state.Column }
+
+// 录制模式: 包装真实驱动, 将每次调用及其结果写入w.
+// 被包装驱动的ConnBeginTx, ExecerContext, QueryerContext, Pinger等可选接口都会被转发,
+// 被包装的驱动不支持时按sql包的方式退回到基础接口, 录制不会改变应用的行为
+type Recorder struct {
+	d driver.Driver
+
+	mu sync.Mutex
+	enc *json.Encoder
+	err error
+	opened bool
+}
+
+func NewRecorder(d driver.Driver, w io.Writer) *Recorder {
+	return &Recorder{d: d, enc: json.NewEncoder(w)}
+}
+
+// 返回写入录制文件时遇到的第一个错误
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(e *entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(e)
+	}
+}
+
+func (r *Recorder) Open(name string) (driver.Conn, error) {
+	ci, err := r.d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c := &recConn{r: r, ci: ci}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 以第一个连接声明的能力作为文件头, 回放的连接照此声明
+	if !r.opened && r.err == nil {
+		r.opened = true
+		r.err = r.enc.Encode(&entry{
+			Op: opHeader,
+			Uint64: c.SupportsUint64(),
+			ValueTypes: c.ValueTypes() != nil,
+			TransactionalDDL: c.SupportsTransactionalDDL(),
+		})
+	}
+	return c, nil
+}
+
+type recConn struct {
+	r *Recorder
+	ci driver.Conn
+}
+
+var (
+	_ driver.ConnPrepareContext = (*recConn)(nil)
+	_ driver.ConnBeginTx = (*recConn)(nil)
+	_ driver.ExecerContext = (*recConn)(nil)
+	_ driver.QueryerContext = (*recConn)(nil)
+	_ driver.Pinger = (*recConn)(nil)
+	_ driver.Uint64Supporter = (*recConn)(nil)
+	_ driver.ValueTypesProvider = (*recConn)(nil)
+	_ driver.TransactionalDDLSupporter = (*recConn)(nil)
+)
+
+func (c *recConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *recConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var si driver.Stmt
+	var err error
+	if p, ok := c.ci.(driver.ConnPrepareContext); ok {
+		si, err = p.PrepareContext(ctx, query)
+	} else {
+		si, err = c.ci.Prepare(query)
+	}
+	c.r.record((&entry{Op: opPrepare, Query: query}).setErr(err))
+	if err != nil {
+		return nil, err
+	}
+	return &recStmt{r: c.r, query: query, si: si}, nil
+}
+
+func (c *recConn) Close() error {
+	return c.ci.Close()
+}
+
+func (c *recConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *recConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var txi driver.Tx
+	var err error
+	if b, ok := c.ci.(driver.ConnBeginTx); ok {
+		txi, err = b.BeginTx(ctx, opts)
+	} else if opts.Isolation != 0 {
+		err = errors.New("sql: selected isolation level is not supported")
+	} else if opts.ReadOnly {
+		err = errors.New("sql: driver does not support read-only transactions")
+	} else {
+		txi, err = c.ci.Begin()
+	}
+	c.r.record((&entry{Op: opBegin, Isolation: int(opts.Isolation), ReadOnly: opts.ReadOnly}).setErr(err))
+	if err != nil {
+		return nil, err
+	}
+	return &recTx{r: c.r, txi: txi}, nil
+}
+
+// 被包装的驱动不支持直接执行时返回driver.ErrSkip, 由sql包改为预处理后执行
+func (c *recConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	var res driver.Result
+	var err error
+	switch ci := c.ci.(type) {
+	case driver.ExecerContext:
+		res, err = ci.ExecContext(ctx, query, args)
+	case driver.Execer:
+		var dargs []driver.Value
+		if dargs, err = positionalArgs(args); err == nil {
+			if err = ctx.Err(); err == nil {
+				res, err = ci.Exec(query, dargs)
+			}
+		}
+	default:
+		return nil, driver.ErrSkip
+	}
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	c.r.record(execEntry(query, args, res, err))
+	return res, err
+}
+
+func (c *recConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var rows driver.Rows
+	var err error
+	switch ci := c.ci.(type) {
+	case driver.QueryerContext:
+		rows, err = ci.QueryContext(ctx, query, args)
+	case driver.Queryer:
+		var dargs []driver.Value
+		if dargs, err = positionalArgs(args); err == nil {
+			if err = ctx.Err(); err == nil {
+				rows, err = ci.Query(query, dargs)
+			}
+		}
+	default:
+		return nil, driver.ErrSkip
+	}
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	return c.r.recordQuery(query, args, rows, err)
+}
+
+func (c *recConn) Ping(ctx context.Context) error {
+	if p, ok := c.ci.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *recConn) SupportsUint64() bool {
+	u, ok := c.ci.(driver.Uint64Supporter)
+	return ok && u.SupportsUint64()
+}
+
+func (c *recConn) ValueTypes() *driver.ValueTypes {
+	if p, ok := c.ci.(driver.ValueTypesProvider); ok {
+		return p.ValueTypes()
+	}
+	return nil
+}
+
+func (c *recConn) SupportsTransactionalDDL() bool {
+	t, ok := c.ci.(driver.TransactionalDDLSupporter)
+	return ok && t.SupportsTransactionalDDL()
+}
+
+func execEntry(query string, args []driver.NamedValue, res driver.Result, err error) *entry {
+	e := (&entry{Op: opExec, Query: query, Args: encodeArgs(args)}).setErr(err)
+	if err == nil {
+		e.LastInsertId, _ = res.LastInsertId()
+		e.RowsAffected, _ = res.RowsAffected()
+	}
+	return e
+}
+
+// 查询结果会被完整读出后写入录制文件, 再交给调用方
+func (r *Recorder) recordQuery(query string, args []driver.NamedValue, rows driver.Rows, err error) (driver.Rows, error) {
+	e := &entry{Op: opQuery, Query: query, Args: encodeArgs(args)}
+	if err != nil {
+		r.record(e.setErr(err))
+		return nil, err
+	}
+	e.Columns = rows.Columns()
+	var data [][]driver.Value
+	for {
+		dest := make([]driver.Value, len(e.Columns))
+		err = rows.Next(dest)
+		if err != nil {
+			break
+		}
+		for i, v := range dest {
+			if b, ok := v.([]byte); ok {
+				dest[i] = append([]byte(nil), b...)
+			}
+		}
+		data = append(data, dest)
+		e.Rows = append(e.Rows, encodeRow(dest))
+	}
+	rows.Close()
+	if err != io.EOF {
+		r.record(e.setErr(err))
+		return nil, err
+	}
+	r.record(e)
+	return &replayRows{columns: e.Columns, rows: data}, nil
+}
+
+type recTx struct {
+	r *Recorder
+	txi driver.Tx
+}
+
+func (tx *recTx) Commit() error {
+	err := tx.txi.Commit()
+	tx.r.record((&entry{Op: opCommit}).setErr(err))
+	return err
+}
+
+func (tx *recTx) Rollback() error {
+	err := tx.txi.Rollback()
+	tx.r.record((&entry{Op: opRollback}).setErr(err))
+	return err
+}
+
+type recStmt struct {
+	r *Recorder
+	query string
+	si driver.Stmt
+}
+
+var (
+	_ driver.StmtExecContext = (*recStmt)(nil)
+	_ driver.StmtQueryContext = (*recStmt)(nil)
+)
+
+func (s *recStmt) Close() error {
+	return s.si.Close()
+}
+
+func (s *recStmt) NumInput() int {
+	return s.si.NumInput()
+}
+
+func (s *recStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedArgs(args))
+}
+
+func (s *recStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var res driver.Result
+	var err error
+	if si, ok := s.si.(driver.StmtExecContext); ok {
+		res, err = si.ExecContext(ctx, args)
+	} else {
+		var dargs []driver.Value
+		if dargs, err = positionalArgs(args); err == nil {
+			res, err = s.si.Exec(dargs)
+		}
+	}
+	s.r.record(execEntry(s.query, args, res, err))
+	return res, err
+}
+
+func (s *recStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedArgs(args))
+}
+
+func (s *recStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var rows driver.Rows
+	var err error
+	if si, ok := s.si.(driver.StmtQueryContext); ok {
+		rows, err = si.QueryContext(ctx, args)
+	} else {
+		var dargs []driver.Value
+		if dargs, err = positionalArgs(args); err == nil {
+			rows, err = s.si.Query(dargs)
+		}
+	}
+	return s.r.recordQuery(s.query, args, rows, err)
+}
+
+// 回放模式: 不连接数据库, 按录制顺序逐条匹配调用.
+// 连接按录制文件头声明Uint64Supporter和TransactionalDDLSupporter;
+// 录制时驱动提供了ValueTypes的, 需要先用SetValueTypes提供同样的类型
+type Replayer struct {
+	header entry
+	valueTypes *driver.ValueTypes
+
+	mu sync.Mutex
+	entries []*entry
+	pos int
+}
+
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	data, err := readAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*entry
+	for i, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		e := new(entry)
+		if err := json.Unmarshal(line, e); err != nil {
+			return nil, fmt.Errorf("replay: line %d: %v", i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	rp := &Replayer{entries: entries}
+	if len(entries) > 0 && entries[0].Op == opHeader {
+		rp.header, rp.entries = *entries[0], entries[1:]
+	}
+	return rp, nil
+}
+
+// 录制时驱动提供的ValueTypes无法写入录制文件, 回放前由调用方提供
+func (r *Replayer) SetValueTypes(vt *driver.ValueTypes) {
+	r.valueTypes = vt
+}
+
+func readAll(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	p := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(p)
+		buf.Write(p[:n])
+		if err == io.EOF {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// 录制的调用是否已全部回放
+func (r *Replayer) Done() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pos < len(r.entries) {
+		return fmt.Errorf("replay: %d recorded calls were not replayed", len(r.entries)-r.pos)
+	}
+	return nil
+}
+
+// 按录制顺序匹配want, 比较操作、语句、参数以及事务选项
+func (r *Replayer) next(want *entry) (*entry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pos >= len(r.entries) {
+		return nil, fmt.Errorf("replay: unmatched %s %q: recording exhausted", want.Op, want.Query)
+	}
+	e := r.entries[r.pos]
+	if e.Op != want.Op || e.Query != want.Query || e.Isolation != want.Isolation ||
+		e.ReadOnly != want.ReadOnly || !sameArgs(e.Args, want.Args) {
+		return nil, fmt.Errorf("replay: unmatched %s %q with args %v: recording has %s %q", want.Op, want.Query, want.Args, e.Op, e.Query)
+	}
+	r.pos++
+	return e, nil
+}
+
+// 录制时被包装的驱动不支持直接执行, 下一条记录是同一语句的预处理
+func (r *Replayer) preparedNext(query string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pos < len(r.entries) && r.entries[r.pos].Op == opPrepare && r.entries[r.pos].Query == query
+}
+
+// 按JSON编码比较, 避免time.Time的时区和单调时钟影响匹配
+func sameArgs(a, b []value) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(ja) == string(jb)
+}
+
+func (r *Replayer) Open(name string) (driver.Conn, error) {
+	if r.header.ValueTypes && r.valueTypes == nil {
+		return nil, errors.New("replay: recording used driver value types; call SetValueTypes first")
+	}
+	return &replayConn{r: r}, nil
+}
+
+type replayConn struct {
+	r *Replayer
+}
+
+var (
+	_ driver.ConnBeginTx = (*replayConn)(nil)
+	_ driver.ExecerContext = (*replayConn)(nil)
+	_ driver.QueryerContext = (*replayConn)(nil)
+	_ driver.Pinger = (*replayConn)(nil)
+	_ driver.Uint64Supporter = (*replayConn)(nil)
+	_ driver.ValueTypesProvider = (*replayConn)(nil)
+	_ driver.TransactionalDDLSupporter = (*replayConn)(nil)
+)
+
+func (c *replayConn) Prepare(query string) (driver.Stmt, error) {
+	e, err := c.r.next(&entry{Op: opPrepare, Query: query})
+	if err != nil {
+		return nil, err
+	}
+	if err := e.error(); err != nil {
+		return nil, err
+	}
+	return &replayStmt{r: c.r, query: query}, nil
+}
+
+func (c *replayConn) Close() error {
+	return nil
+}
+
+func (c *replayConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *replayConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	e, err := c.r.next(&entry{Op: opBegin, Isolation: int(opts.Isolation), ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	if err := e.error(); err != nil {
+		return nil, err
+	}
+	return &replayTx{r: c.r}, nil
+}
+
+func (c *replayConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.r.preparedNext(query) {
+		return nil, driver.ErrSkip
+	}
+	return c.r.exec(query, args)
+}
+
+func (c *replayConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.r.preparedNext(query) {
+		return nil, driver.ErrSkip
+	}
+	return c.r.query(query, args)
+}
+
+func (c *replayConn) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *replayConn) SupportsUint64() bool {
+	return c.r.header.Uint64
+}
+
+func (c *replayConn) ValueTypes() *driver.ValueTypes {
+	return c.r.valueTypes
+}
+
+func (c *replayConn) SupportsTransactionalDDL() bool {
+	return c.r.header.TransactionalDDL
+}
+
+func (r *Replayer) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	e, err := r.next(&entry{Op: opExec, Query: query, Args: encodeArgs(args)})
+	if err != nil {
+		return nil, err
+	}
+	if err := e.error(); err != nil {
+		return nil, err
+	}
+	return replayResult{e.LastInsertId, e.RowsAffected}, nil
+}
+
+func (r *Replayer) query(query string, args []driver.NamedValue) (driver.Rows, error) {
+	e, err := r.next(&entry{Op: opQuery, Query: query, Args: encodeArgs(args)})
+	if err != nil {
+		return nil, err
+	}
+	if err := e.error(); err != nil {
+		return nil, err
+	}
+	rows := make([][]driver.Value, len(e.Rows))
+	for i, row := range e.Rows {
+		rows[i] = make([]driver.Value, len(row))
+		for j, v := range row {
+			if rows[i][j], err = v.decode(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &replayRows{columns: e.Columns, rows: rows}, nil
+}
+
+type replayTx struct {
+	r *Replayer
+}
+
+func (tx *replayTx) Commit() error {
+	e, err := tx.r.next(&entry{Op: opCommit})
+	if err != nil {
+		return err
+	}
+	return e.error()
+}
+
+func (tx *replayTx) Rollback() error {
+	e, err := tx.r.next(&entry{Op: opRollback})
+	if err != nil {
+		return err
+	}
+	return e.error()
+}
+
+type replayStmt struct {
+	r *Replayer
+	query string
+}
+
+var (
+	_ driver.StmtExecContext = (*replayStmt)(nil)
+	_ driver.StmtQueryContext = (*replayStmt)(nil)
+)
+
+func (s *replayStmt) Close() error {
+	return nil
+}
+
+func (s *replayStmt) NumInput() int {
+	return -1
+}
+
+func (s *replayStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.r.exec(s.query, namedArgs(args))
+}
+
+func (s *replayStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.r.exec(s.query, args)
+}
+
+func (s *replayStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.r.query(s.query, namedArgs(args))
+}
+
+func (s *replayStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.r.query(s.query, args)
+}
+
+type replayResult struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (r replayResult) LastInsertId() (int64, error) {
+	return r.lastInsertId, nil
+}
+
+func (r replayResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type replayRows struct {
+	columns []string
+	rows [][]driver.Value
+	pos int
+}
+
+func (r *replayRows) Columns() []string {
+	return r.columns
+}
+
+func (r *replayRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func (r *replayRows) Close() error {
+	r.pos = len(r.rows)
+	return nil
+}
@@ -0,0 +1,327 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type buffer struct {
+	b []byte
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.b = append(b.b, p...)
+	return len(p), nil
+}
+
+func (b *buffer) Read(p []byte) (int, error) {
+	if len(b.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.b)
+	b.b = b.b[n:]
+	return n, nil
+}
+
+type connector struct {
+	d driver.Driver
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.d }
+
+// 支持上下文接口的驱动, 记录收到的事务选项
+type ctxDriver struct {
+	opts []driver.TxOptions
+}
+
+func (d *ctxDriver) Open(string) (driver.Conn, error) { return &ctxConn{d}, nil }
+
+type ctxConn struct {
+	d *ctxDriver
+}
+
+func (c *ctxConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("unexpected Prepare") }
+func (c *ctxConn) Close() error                        { return nil }
+func (c *ctxConn) Begin() (driver.Tx, error)           { return nil, errors.New("unexpected Begin") }
+func (c *ctxConn) Commit() error                       { return nil }
+func (c *ctxConn) Rollback() error                     { return nil }
+
+func (c *ctxConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.d.opts = append(c.d.opts, opts)
+	return c, nil
+}
+
+func (c *ctxConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (c *ctxConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &testRows{n: 2}, nil
+}
+
+// 只支持预处理语句的旧接口驱动
+type legacyDriver struct{}
+
+func (legacyDriver) Open(string) (driver.Conn, error) { return legacyConn{}, nil }
+
+type legacyConn struct{}
+
+func (legacyConn) Prepare(string) (driver.Stmt, error) { return legacyStmt{}, nil }
+func (legacyConn) Close() error                        { return nil }
+func (legacyConn) Begin() (driver.Tx, error)           { return legacyConn{}, nil }
+func (legacyConn) Commit() error                       { return nil }
+func (legacyConn) Rollback() error                     { return nil }
+
+type legacyStmt struct{}
+
+func (legacyStmt) Close() error  { return nil }
+func (legacyStmt) NumInput() int { return -1 }
+func (legacyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(len(args)), nil
+}
+func (legacyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &testRows{n: 2}, nil
+}
+
+type testRows struct {
+	n int
+}
+
+func (r *testRows) Columns() []string { return []string{"id", "name"} }
+func (r *testRows) Close() error      { return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.n == 0 {
+		return io.EOF
+	}
+	r.n--
+	dest[0], dest[1] = int64(r.n), []byte("row")
+	return nil
+}
+
+type result struct {
+	affected []int64
+	ids []int64
+}
+
+func workload(d driver.Driver, opts *sql.TxOptions) (*result, error) {
+	ctx := context.Background()
+	db := sql.OpenDB(connector{d})
+	res := new(result)
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	r, err := tx.ExecContext(ctx, "UPDATE t SET f = ?", math.NaN(), math.Inf(-1))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	n, _ := r.RowsAffected()
+	res.affected = append(res.affected, n)
+	rows, err := tx.QueryContext(ctx, "SELECT id, name FROM t WHERE name = ?", "row")
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		res.ids = append(res.ids, id)
+	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	r, err = db.ExecContext(ctx, "DELETE FROM t WHERE id = ?", int64(1))
+	if err != nil {
+		return nil, err
+	}
+	n, _ = r.RowsAffected()
+	res.affected = append(res.affected, n)
+	return res, nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		d driver.Driver
+		opts *sql.TxOptions
+	}{
+		{"context", &ctxDriver{}, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}},
+		{"legacy", legacyDriver{}, nil},
+	}
+	for _, tt := range tests {
+		var buf buffer
+		rec := NewRecorder(tt.d, &buf)
+		want, err := workload(rec, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: record: %v", tt.name, err)
+		}
+		if err := rec.Err(); err != nil {
+			t.Fatalf("%s: recorder: %v", tt.name, err)
+		}
+		if cd, ok := tt.d.(*ctxDriver); ok {
+			if len(cd.opts) != 1 || cd.opts[0].Isolation != driver.IsolationLevel(sql.LevelSerializable) || !cd.opts[0].ReadOnly {
+				t.Errorf("%s: driver got tx options %+v", tt.name, cd.opts)
+			}
+		}
+		rp, err := NewReplayer(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := workload(rp, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: replay: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: replay = %+v; want %+v", tt.name, got, want)
+		}
+		if err := rp.Done(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestReplayUnmatched(t *testing.T) {
+	var buf buffer
+	if _, err := workload(NewRecorder(&ctxDriver{}, &buf), nil); err != nil {
+		t.Fatal(err)
+	}
+	rp, err := NewReplayer(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector{rp})
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.ExecContext(context.Background(), "UPDATE t SET f = ?", 1.5, 2.5)
+	if err == nil || !strings.Contains(err.Error(), "unmatched") {
+		t.Errorf("ExecContext with different args = %v; want unmatched error", err)
+	}
+	if rp.Done() == nil {
+		t.Error("Done reported success with calls left unreplayed")
+	}
+
+	rp, _ = NewReplayer(&buffer{})
+	if _, err := rp.Open(""); err != nil {
+		t.Fatal(err)
+	}
+	_, err = sql.OpenDB(connector{rp}).ExecContext(context.Background(), "DELETE FROM t")
+	if err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Errorf("ExecContext on empty recording = %v; want exhausted error", err)
+	}
+}
+
+// 声明了各种能力的驱动, 按语句返回不同的错误
+type capsDriver struct{}
+
+func (capsDriver) Open(string) (driver.Conn, error) { return capsConn{}, nil }
+
+type capsConn struct {
+	driver.Conn
+}
+
+func (capsConn) Close() error                   { return nil }
+func (capsConn) SupportsUint64() bool           { return true }
+func (capsConn) SupportsTransactionalDDL() bool { return true }
+func (capsConn) ValueTypes() *driver.ValueTypes { return driver.NewValueTypes() }
+func (capsConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	switch query {
+	case "bad":
+		return nil, driver.ErrBadConn
+	case "dup":
+		return nil, wrapErr{stateErr{}}
+	}
+	return nil, errors.New("plain")
+}
+
+type stateErr struct{}
+
+func (stateErr) Error() string      { return "duplicate key" }
+func (stateErr) SQLState() string   { return "23505" }
+func (stateErr) Severity() string   { return "ERROR" }
+func (stateErr) Constraint() string { return "t_pkey" }
+func (stateErr) Table() string      { return "t" }
+func (stateErr) Column() string     { return "" }
+
+type wrapErr struct {
+	err error
+}
+
+func (e wrapErr) Error() string { return "exec: " + e.err.Error() }
+func (e wrapErr) Unwrap() error { return e.err }
+
+func TestReplayCapabilitiesAndErrors(t *testing.T) {
+	var buf buffer
+	rec := NewRecorder(capsDriver{}, &buf)
+	ci, err := rec.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{"bad", "dup", "plain"} {
+		ci.(driver.ExecerContext).ExecContext(context.Background(), q, nil)
+	}
+
+	rp, err := NewReplayer(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.Open(""); err == nil {
+		t.Fatal("Open succeeded without the recorded value types")
+	}
+	vt := driver.NewValueTypes()
+	rp.SetValueTypes(vt)
+	ci, err = rp.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ci.(driver.Uint64Supporter).SupportsUint64() || !ci.(driver.TransactionalDDLSupporter).SupportsTransactionalDDL() {
+		t.Error("replay conn lost the recorded capabilities")
+	}
+	if ci.(driver.ValueTypesProvider).ValueTypes() != vt {
+		t.Error("replay conn did not report the value types")
+	}
+
+	execer := ci.(driver.ExecerContext)
+	if _, err := execer.ExecContext(context.Background(), "bad", nil); err != driver.ErrBadConn {
+		t.Errorf("replayed bad conn = %v; want driver.ErrBadConn", err)
+	}
+	_, err = execer.ExecContext(context.Background(), "dup", nil)
+	de, ok := err.(driver.Error)
+	if !ok || de.SQLState() != "23505" || de.Constraint() != "t_pkey" || err.Error() != "exec: duplicate key" {
+		t.Errorf("replayed driver error = %#v; want SQLSTATE 23505", err)
+	}
+	if _, err := execer.ExecContext(context.Background(), "plain", nil); err == nil || err.Error() != "plain" {
+		t.Errorf("replayed error = %v; want plain", err)
+	}
+}
+
+func TestReplayBadValue(t *testing.T) {
+	rp, err := NewReplayer(&buffer{[]byte(`{"op":"query","query":"q","columns":["u"],"rows":[[{"t":"uint64","s":"x"}]]}` + "\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci, err := rp.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ci.(driver.QueryerContext).QueryContext(context.Background(), "q", nil)
+	if err == nil || !strings.Contains(err.Error(), "bad uint64") {
+		t.Errorf("QueryContext = %v; want a bad uint64 error", err)
+	}
+}
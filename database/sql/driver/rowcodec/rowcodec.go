@@ -0,0 +1,604 @@
+// 将driver.Rows的列信息和各行数据编码为紧凑的二进制格式, 并能解码还原为driver.Rows,
+// 用于缓存结果集、落盘以及在进程间传递查询结果
+//
+// 格式: 魔数"GDKR", 1字节版本号, 列头, 之后每行以rowMarker开头, 以endMarker结束,
+// 整数均使用varint编码
+package rowcodec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"math"
+	"reflect"
+	"time"
+)
+
+const (
+	magic = "GDKR"
+	Version = 1
+)
+
+const (
+	endMarker byte = 0
+	rowMarker byte = 1
+)
+
+// 值的类型标记
+const (
+	tagNull byte = iota
+	tagInt64
+	tagUint64
+	tagFloat64
+	tagFalse
+	tagTrue
+	tagString
+	tagBytes
+	tagTime // 非UTC时间只保留时区偏移, 不保留时区名
+	tagTimeUTC
+)
+
+// 列元数据中ok标志位
+const (
+	hasLength byte = 1 << iota
+	hasNullable
+	isNullable
+	hasPrecisionScale
+)
+
+// 列数和值长度都来自输入, 超出上限按格式错误处理, 避免按损坏的长度分配内存
+const (
+	maxColumns = 1 << 16
+	maxValueLen = 1 << 30
+	// 长值分块读取, 截断的输入在分配全部内存之前就会出错
+	readChunk = 64 << 10
+)
+
+var (
+	ErrFormat = errors.New("rowcodec: invalid format")
+	ErrVersion = errors.New("rowcodec: unsupported version")
+
+	errTooManyColumns = errors.New("rowcodec: too many columns")
+	errValueTooLong = errors.New("rowcodec: value too long")
+)
+
+var scanTypes = []reflect.Type{
+	nil,
+	reflect.TypeOf(int64(0)),
+	reflect.TypeOf(uint64(0)),
+	reflect.TypeOf(float64(0)),
+	reflect.TypeOf(false),
+	reflect.TypeOf(""),
+	reflect.TypeOf([]byte(nil)),
+	reflect.TypeOf(time.Time{}),
+	reflect.TypeOf((*interface{})(nil)).Elem(),
+}
+
+func scanTypeTag(t reflect.Type) byte {
+	for i, st := range scanTypes {
+		if i > 0 && st == t {
+			return byte(i)
+		}
+	}
+	return 0
+}
+
+// 一列的元数据, 对应driver.RowsColumnType*接口, ScanType只保留基本类型, 其他类型解码后为nil
+type Column struct {
+	Name string
+	DatabaseTypeName string
+	ScanType reflect.Type
+
+	Length int64
+	HasLength bool
+	Nullable bool
+	HasNullable bool
+	Precision int64
+	Scale int64
+	HasPrecisionScale bool
+}
+
+// 从驱动的结果集中读取列元数据, 驱动未实现的接口对应字段保持零值
+func ColumnsOf(rows driver.Rows) []Column {
+	names := rows.Columns()
+	cols := make([]Column, len(names))
+	for i, name := range names {
+		c := &cols[i]
+		c.Name = name
+		if r, ok := rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+			c.DatabaseTypeName = r.ColumnTypeDatabaseTypeName(i)
+		}
+		if r, ok := rows.(driver.RowsColumnTypeScanType); ok {
+			c.ScanType = r.ColumnTypeScanType(i)
+		}
+		if r, ok := rows.(driver.RowsColumnTypeLength); ok {
+			c.Length, c.HasLength = r.ColumnTypeLength(i)
+		}
+		if r, ok := rows.(driver.RowsColumnTypeNullable); ok {
+			c.Nullable, c.HasNullable = r.ColumnTypeNullable(i)
+		}
+		if r, ok := rows.(driver.RowsColumnTypePrecisionScale); ok {
+			c.Precision, c.Scale, c.HasPrecisionScale = r.ColumnTypePrecisionScale(i)
+		}
+	}
+	return cols
+}
+
+type Encoder struct {
+	w io.Writer
+	ncols int
+	buf []byte
+	closed bool
+}
+
+// 写入格式头和列信息
+func NewEncoder(w io.Writer, cols []Column) (*Encoder, error) {
+	if len(cols) > maxColumns {
+		return nil, errTooManyColumns
+	}
+	e := &Encoder{w: w, ncols: len(cols)}
+	e.buf = append(e.buf, magic...)
+	e.buf = append(e.buf, Version)
+	e.buf = appendUvarint(e.buf, uint64(len(cols)))
+	for _, c := range cols {
+		e.buf = appendString(e.buf, c.Name)
+		e.buf = appendString(e.buf, c.DatabaseTypeName)
+		e.buf = append(e.buf, scanTypeTag(c.ScanType))
+		var flags byte
+		if c.HasLength {
+			flags |= hasLength
+		}
+		if c.HasNullable {
+			flags |= hasNullable
+		}
+		if c.Nullable {
+			flags |= isNullable
+		}
+		if c.HasPrecisionScale {
+			flags |= hasPrecisionScale
+		}
+		e.buf = append(e.buf, flags)
+		if c.HasLength {
+			e.buf = appendVarint(e.buf, c.Length)
+		}
+		if c.HasPrecisionScale {
+			e.buf = appendVarint(e.buf, c.Precision)
+			e.buf = appendVarint(e.buf, c.Scale)
+		}
+	}
+	if err := e.flush(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Encoder) flush() error {
+	_, err := e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
+}
+
+func (e *Encoder) Encode(row []driver.Value) error {
+	if e.closed {
+		return errors.New("rowcodec: encoder is closed")
+	}
+	if len(row) != e.ncols {
+		return fmt.Errorf("rowcodec: got %d values, want %d", len(row), e.ncols)
+	}
+	e.buf = append(e.buf, rowMarker)
+	for i, v := range row {
+		var err error
+		e.buf, err = appendValue(e.buf, v)
+		if err != nil {
+			e.buf = e.buf[:0]
+			return fmt.Errorf("rowcodec: column %d: %v", i, err)
+		}
+	}
+	return e.flush()
+}
+
+// 写入结束标记, 不会关闭底层的Writer
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	e.buf = append(e.buf, endMarker)
+	return e.flush()
+}
+
+// 读完rows并全部编码到w, 返回写入的行数, 不会关闭rows
+func WriteRows(w io.Writer, rows driver.Rows) (int64, error) {
+	cols := ColumnsOf(rows)
+	e, err := NewEncoder(w, cols)
+	if err != nil {
+		return 0, err
+	}
+	dest := make([]driver.Value, len(cols))
+	var n int64
+	for {
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := e.Encode(dest); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, e.Close()
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendValue(b []byte, v driver.Value) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, tagNull), nil
+	case int64:
+		return appendVarint(append(b, tagInt64), v), nil
+	case uint64:
+		return appendUvarint(append(b, tagUint64), v), nil
+	case float64:
+		b = append(b, tagFloat64)
+		var tmp [8]byte
+		binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(v))
+		return append(b, tmp[:]...), nil
+	case bool:
+		if v {
+			return append(b, tagTrue), nil
+		}
+		return append(b, tagFalse), nil
+	case string:
+		if len(v) > maxValueLen {
+			return b, errValueTooLong
+		}
+		return appendString(append(b, tagString), v), nil
+	case []byte:
+		if len(v) > maxValueLen {
+			return b, errValueTooLong
+		}
+		b = appendUvarint(append(b, tagBytes), uint64(len(v)))
+		return append(b, v...), nil
+	case time.Time:
+		if v.Location() == time.UTC {
+			b = append(b, tagTimeUTC)
+		} else {
+			_, offset := v.Zone()
+			b = appendVarint(append(b, tagTime), int64(offset))
+		}
+		b = appendVarint(b, v.Unix())
+		return appendUvarint(b, uint64(v.Nanosecond())), nil
+	}
+	return b, fmt.Errorf("unsupported type %T", v)
+}
+
+// 解码得到的结果集, 实现driver.Rows以及各个RowsColumnType*接口
+type Rows struct {
+	r *reader
+	cols []Column
+	names []string
+	done bool
+	err error
+}
+
+var (
+	_ driver.RowsColumnTypeScanType = (*Rows)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*Rows)(nil)
+	_ driver.RowsColumnTypeLength = (*Rows)(nil)
+	_ driver.RowsColumnTypeNullable = (*Rows)(nil)
+	_ driver.RowsColumnTypePrecisionScale = (*Rows)(nil)
+)
+
+// 读取格式头和列信息, 行数据在调用Next时按需读取
+func NewRows(r io.Reader) (*Rows, error) {
+	rd := &reader{r: r}
+	var head [len(magic) + 1]byte
+	if err := rd.readFull(head[:]); err != nil {
+		return nil, err
+	}
+	if string(head[:len(magic)]) != magic {
+		return nil, ErrFormat
+	}
+	if head[len(magic)] != Version {
+		return nil, ErrVersion
+	}
+	n, err := rd.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxColumns {
+		return nil, ErrFormat
+	}
+	rs := &Rows{r: rd, cols: make([]Column, n), names: make([]string, n)}
+	for i := range rs.cols {
+		c := &rs.cols[i]
+		if c.Name, err = rd.string(); err != nil {
+			return nil, err
+		}
+		if c.DatabaseTypeName, err = rd.string(); err != nil {
+			return nil, err
+		}
+		tag, err := rd.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if int(tag) >= len(scanTypes) {
+			return nil, ErrFormat
+		}
+		c.ScanType = scanTypes[tag]
+		flags, err := rd.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		c.HasNullable = flags&hasNullable != 0
+		c.Nullable = flags&isNullable != 0
+		if flags&hasLength != 0 {
+			c.HasLength = true
+			if c.Length, err = rd.varint(); err != nil {
+				return nil, err
+			}
+		}
+		if flags&hasPrecisionScale != 0 {
+			c.HasPrecisionScale = true
+			if c.Precision, err = rd.varint(); err != nil {
+				return nil, err
+			}
+			if c.Scale, err = rd.varint(); err != nil {
+				return nil, err
+			}
+		}
+		rs.names[i] = c.Name
+	}
+	return rs, nil
+}
+
+func (rs *Rows) Columns() []string {
+	return rs.names
+}
+
+// 返回解码得到的列元数据
+func (rs *Rows) ColumnInfo() []Column {
+	return rs.cols
+}
+
+func (rs *Rows) Next(dest []driver.Value) error {
+	if rs.err != nil {
+		return rs.err
+	}
+	if rs.done {
+		return io.EOF
+	}
+	marker, err := rs.r.ReadByte()
+	if err != nil {
+		rs.err = err
+		return err
+	}
+	switch marker {
+	case endMarker:
+		rs.done = true
+		return io.EOF
+	case rowMarker:
+	default:
+		rs.err = ErrFormat
+		return rs.err
+	}
+	for i := range rs.cols {
+		v, err := rs.r.value()
+		if err != nil {
+			rs.err = err
+			return err
+		}
+		if i < len(dest) {
+			dest[i] = v
+		}
+	}
+	return nil
+}
+
+func (rs *Rows) Close() error {
+	rs.done = true
+	return nil
+}
+
+func (rs *Rows) ColumnTypeScanType(index int) reflect.Type {
+	if t := rs.cols[index].ScanType; t != nil {
+		return t
+	}
+	return scanTypes[len(scanTypes)-1]
+}
+
+func (rs *Rows) ColumnTypeDatabaseTypeName(index int) string {
+	return rs.cols[index].DatabaseTypeName
+}
+
+func (rs *Rows) ColumnTypeLength(index int) (int64, bool) {
+	return rs.cols[index].Length, rs.cols[index].HasLength
+}
+
+func (rs *Rows) ColumnTypeNullable(index int) (bool, bool) {
+	return rs.cols[index].Nullable, rs.cols[index].HasNullable
+}
+
+func (rs *Rows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	c := rs.cols[index]
+	return c.Precision, c.Scale, c.HasPrecisionScale
+}
+
+// 带缓冲的读取, 数据在结束标记之前耗尽时返回io.ErrUnexpectedEOF
+type reader struct {
+	r io.Reader
+	buf [4096]byte
+	pos, end int
+	err error
+}
+
+func (rd *reader) fill() error {
+	if rd.err != nil {
+		return rd.err
+	}
+	n, err := rd.r.Read(rd.buf[:])
+	rd.pos, rd.end = 0, n
+	if n > 0 {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	rd.err = err
+	return err
+}
+
+func (rd *reader) ReadByte() (byte, error) {
+	for rd.pos >= rd.end {
+		if err := rd.fill(); err != nil {
+			return 0, err
+		}
+	}
+	c := rd.buf[rd.pos]
+	rd.pos++
+	return c, nil
+}
+
+func (rd *reader) readFull(p []byte) error {
+	for len(p) > 0 {
+		if rd.pos >= rd.end {
+			if err := rd.fill(); err != nil {
+				return err
+			}
+		}
+		n := copy(p, rd.buf[rd.pos:rd.end])
+		rd.pos += n
+		p = p[n:]
+	}
+	return nil
+}
+
+func (rd *reader) uvarint() (uint64, error) {
+	var x uint64
+	var s uint
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		c, err := rd.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c < 0x80 {
+			if i == binary.MaxVarintLen64-1 && c > 1 {
+				return 0, ErrFormat
+			}
+			return x | uint64(c)<<s, nil
+		}
+		x |= uint64(c&0x7f) << s
+		s += 7
+	}
+	return 0, ErrFormat
+}
+
+func (rd *reader) varint() (int64, error) {
+	ux, err := rd.uvarint()
+	x := int64(ux >> 1)
+	if ux&1 != 0 {
+		x = ^x
+	}
+	return x, err
+}
+
+func (rd *reader) bytes() ([]byte, error) {
+	n, err := rd.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxValueLen {
+		return nil, ErrFormat
+	}
+	size := int(n)
+	if size > readChunk {
+		size = readChunk
+	}
+	b := make([]byte, size)
+	if err := rd.readFull(b); err != nil {
+		return nil, err
+	}
+	for len(b) < int(n) {
+		m := int(n) - len(b)
+		if m > readChunk {
+			m = readChunk
+		}
+		b = append(b, make([]byte, m)...)
+		if err := rd.readFull(b[len(b)-m:]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (rd *reader) string() (string, error) {
+	b, err := rd.bytes()
+	return string(b), err
+}
+
+func (rd *reader) value() (driver.Value, error) {
+	tag, err := rd.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagNull:
+		return nil, nil
+	case tagInt64:
+		return rd.varint()
+	case tagUint64:
+		return rd.uvarint()
+	case tagFloat64:
+		var tmp [8]byte
+		if err := rd.readFull(tmp[:]); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(tmp[:])), nil
+	case tagFalse:
+		return false, nil
+	case tagTrue:
+		return true, nil
+	case tagString:
+		return rd.string()
+	case tagBytes:
+		return rd.bytes()
+	case tagTime, tagTimeUTC:
+		loc := time.UTC
+		if tag == tagTime {
+			offset, err := rd.varint()
+			if err != nil {
+				return nil, err
+			}
+			loc = time.FixedZone("", int(offset))
+		}
+		sec, err := rd.varint()
+		if err != nil {
+			return nil, err
+		}
+		nsec, err := rd.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		return time.Unix(sec, int64(nsec)).In(loc), nil
+	}
+	return nil, ErrFormat
+}
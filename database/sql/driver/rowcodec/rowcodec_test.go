@@ -0,0 +1,163 @@
+package rowcodec
+
+import (
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type buffer struct {
+	b []byte
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.b = append(b.b, p...)
+	return len(p), nil
+}
+
+func (b *buffer) Read(p []byte) (int, error) {
+	if len(b.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.b)
+	b.b = b.b[n:]
+	return n, nil
+}
+
+type testRows struct {
+	rows [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return []string{"id", "name", "data", "at"} }
+func (r *testRows) Close() error      { return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+func (r *testRows) ColumnTypeDatabaseTypeName(i int) string {
+	return []string{"BIGINT", "VARCHAR", "BYTEA", "TIMESTAMPTZ"}[i]
+}
+func (r *testRows) ColumnTypeLength(i int) (int64, bool) {
+	return 64, i == 1
+}
+func (r *testRows) ColumnTypeNullable(i int) (bool, bool) {
+	return i != 0, true
+}
+
+func TestRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 5, 10, 20, 30, 123, time.FixedZone("", 8*3600))
+	in := [][]driver.Value{
+		{int64(-1), "alice", []byte{0, 1, 2}, at},
+		{int64(1 << 40), nil, []byte{}, at.UTC()},
+		{uint64(1<<64 - 1), "", nil, nil},
+		{3.5, true, false, nil},
+	}
+	var buf buffer
+	n, err := WriteRows(&buf, &testRows{rows: in})
+	if err != nil || n != int64(len(in)) {
+		t.Fatalf("WriteRows = %d, %v", n, err)
+	}
+	rs, err := NewRows(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rs.Columns(); !reflect.DeepEqual(got, []string{"id", "name", "data", "at"}) {
+		t.Errorf("Columns = %v", got)
+	}
+	if got := rs.ColumnTypeDatabaseTypeName(3); got != "TIMESTAMPTZ" {
+		t.Errorf("DatabaseTypeName = %q", got)
+	}
+	if l, ok := rs.ColumnTypeLength(1); l != 64 || !ok {
+		t.Errorf("Length = %d, %v", l, ok)
+	}
+	if _, ok := rs.ColumnTypeLength(0); ok {
+		t.Errorf("Length ok for column without length")
+	}
+	if null, ok := rs.ColumnTypeNullable(0); null || !ok {
+		t.Errorf("Nullable = %v, %v", null, ok)
+	}
+	if _, _, ok := rs.ColumnTypePrecisionScale(0); ok {
+		t.Errorf("PrecisionScale ok for driver without precision")
+	}
+	dest := make([]driver.Value, 4)
+	for i, want := range in {
+		if err := rs.Next(dest); err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		for j, v := range dest {
+			if wt, ok := want[j].(time.Time); ok {
+				gt, _ := v.(time.Time)
+				_, wo := wt.Zone()
+				_, gof := gt.Zone()
+				if !gt.Equal(wt) || wo != gof {
+					t.Errorf("row %d col %d = %v; want %v", i, j, v, wt)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(v, want[j]) {
+				t.Errorf("row %d col %d = %#v; want %#v", i, j, v, want[j])
+			}
+		}
+	}
+	if err := rs.Next(dest); err != io.EOF {
+		t.Errorf("Next after last row = %v; want io.EOF", err)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	var buf buffer
+	WriteRows(&buf, &testRows{rows: [][]driver.Value{{int64(1), "x", nil, nil}}})
+	buf.b = buf.b[:len(buf.b)-1]
+	rs, err := NewRows(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]driver.Value, 4)
+	if err := rs.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Next(dest); err != io.ErrUnexpectedEOF {
+		t.Errorf("Next = %v; want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestBadHeader(t *testing.T) {
+	if _, err := NewRows(&buffer{b: []byte("NOPE\x01\x00")}); err != ErrFormat {
+		t.Errorf("bad magic: %v", err)
+	}
+	if _, err := NewRows(&buffer{b: []byte("GDKR\x09\x00")}); err != ErrVersion {
+		t.Errorf("bad version: %v", err)
+	}
+}
+
+func TestCorruptLengths(t *testing.T) {
+	// 列数超出上限
+	if _, err := NewRows(&buffer{b: append([]byte("GDKR\x01"), appendUvarint(nil, maxColumns+1)...)}); err != ErrFormat {
+		t.Errorf("huge column count: %v; want ErrFormat", err)
+	}
+	// 列名长度超出上限
+	head := append([]byte("GDKR\x01\x01"), appendUvarint(nil, maxValueLen+1)...)
+	if _, err := NewRows(&buffer{b: head}); err != ErrFormat {
+		t.Errorf("huge name length: %v; want ErrFormat", err)
+	}
+	// 长度合法但数据被截断, 不应按声明的长度一次性分配
+	head = append([]byte("GDKR\x01\x01"), appendUvarint(nil, maxValueLen)...)
+	head = append(head, "abc"...)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := NewRows(&buffer{b: head})
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated long name: %v; want io.ErrUnexpectedEOF", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("truncated long name allocated %d bytes", n)
+	}
+}
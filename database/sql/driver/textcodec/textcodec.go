@@ -0,0 +1,324 @@
+// 文本协议中常见类型的解析与格式化, 解析函数直接处理[]byte, 不产生内存分配
+package textcodec
+
+import (
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+var (
+	ErrSyntax = strconv.ErrSyntax
+	ErrRange  = strconv.ErrRange
+)
+
+// bitSize为0时按64位处理
+func ParseInt(b []byte, bitSize int) (int64, error) {
+	if bitSize == 0 {
+		bitSize = 64
+	}
+	if len(b) == 0 {
+		return 0, ErrSyntax
+	}
+	neg := false
+	switch b[0] {
+	case '-':
+		neg = true
+		b = b[1:]
+	case '+':
+		b = b[1:]
+	}
+	u, err := ParseUint(b, bitSize)
+	if err != nil && err != ErrRange {
+		return 0, err
+	}
+	cutoff := uint64(1) << uint(bitSize-1)
+	if err == ErrRange || !neg && u >= cutoff {
+		if neg {
+			return -int64(cutoff), ErrRange
+		}
+		return int64(cutoff - 1), ErrRange
+	}
+	if neg && u > cutoff {
+		return -int64(cutoff), ErrRange
+	}
+	if neg {
+		return -int64(u), nil
+	}
+	return int64(u), nil
+}
+
+func ParseUint(b []byte, bitSize int) (uint64, error) {
+	if bitSize == 0 {
+		bitSize = 64
+	}
+	if len(b) == 0 {
+		return 0, ErrSyntax
+	}
+	max := uint64(1)<<uint(bitSize) - 1
+	var n uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, ErrSyntax
+		}
+		if n > (max-uint64(c-'0'))/10 {
+			return max, ErrRange
+		}
+		n = n*10 + uint64(c-'0')
+	}
+	return n, nil
+}
+
+// 借用b的内存作为字符串, 仅用于不会保留该字符串的调用
+func unsafeString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+func ParseFloat(b []byte, bitSize int) (float64, error) {
+	if bitSize == 0 {
+		bitSize = 64
+	}
+	f, err := strconv.ParseFloat(unsafeString(b), bitSize)
+	if err != nil {
+		if ne, ok := err.(*strconv.NumError); ok {
+			return f, ne.Err
+		}
+		return f, err
+	}
+	return f, nil
+}
+
+// 支持PostgreSQL的t/f以及strconv.ParseBool接受的写法, 不区分大小写
+func ParseBool(b []byte) (bool, error) {
+	var buf [5]byte
+	if len(b) > len(buf) {
+		return false, ErrSyntax
+	}
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		buf[i] = c
+	}
+	switch string(buf[:len(b)]) {
+	case "t", "true", "1", "y", "yes", "on":
+		return true, nil
+	case "f", "false", "0", "n", "no", "off":
+		return false, nil
+	}
+	return false, ErrSyntax
+}
+
+var zones sync.Map
+
+func fixedZone(offset int) *time.Location {
+	if offset == 0 {
+		return time.UTC
+	}
+	if loc, ok := zones.Load(offset); ok {
+		return loc.(*time.Location)
+	}
+	loc, _ := zones.LoadOrStore(offset, time.FixedZone("", offset))
+	return loc.(*time.Location)
+}
+
+// 解析 YYYY-MM-DD[( |T)HH:MM:SS[.fraction]][Z|±HH[:MM[:SS]]]
+// 没有时区信息时使用loc, loc为nil时使用UTC
+func ParseTime(b []byte, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	num := func(i, n int) (int, bool) {
+		if i+n > len(b) {
+			return 0, false
+		}
+		v := 0
+		for _, c := range b[i : i+n] {
+			if c < '0' || c > '9' {
+				return 0, false
+			}
+			v = v*10 + int(c-'0')
+		}
+		return v, true
+	}
+	year, ok1 := num(0, 4)
+	month, ok2 := num(5, 2)
+	day, ok3 := num(8, 2)
+	if !ok1 || !ok2 || !ok3 || b[4] != '-' || b[7] != '-' {
+		return time.Time{}, ErrSyntax
+	}
+	i := 10
+	var hour, min, sec, nsec int
+	if i < len(b) && (b[i] == ' ' || b[i] == 'T') {
+		var ok4, ok5, ok6 bool
+		hour, ok4 = num(i+1, 2)
+		min, ok5 = num(i+4, 2)
+		sec, ok6 = num(i+7, 2)
+		if !ok4 || !ok5 || !ok6 || b[i+3] != ':' || b[i+6] != ':' {
+			return time.Time{}, ErrSyntax
+		}
+		i += 9
+		if i < len(b) && b[i] == '.' {
+			i++
+			digits := 0
+			for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+				if digits < 9 {
+					nsec = nsec*10 + int(b[i]-'0')
+					digits++
+				}
+			}
+			if digits == 0 {
+				return time.Time{}, ErrSyntax
+			}
+			for ; digits < 9; digits++ {
+				nsec *= 10
+			}
+		}
+	}
+	if i < len(b) {
+		switch b[i] {
+		case 'Z':
+			if i+1 != len(b) {
+				return time.Time{}, ErrSyntax
+			}
+			loc = time.UTC
+		case '+', '-':
+			sign := 1
+			if b[i] == '-' {
+				sign = -1
+			}
+			oh, ok := num(i+1, 2)
+			if !ok {
+				return time.Time{}, ErrSyntax
+			}
+			offset := oh * 3600
+			i += 3
+			for _, mul := range []int{60, 1} {
+				if i == len(b) {
+					break
+				}
+				if b[i] == ':' {
+					i++
+				}
+				v, ok := num(i, 2)
+				if !ok {
+					return time.Time{}, ErrSyntax
+				}
+				offset += v * mul
+				i += 2
+			}
+			if i != len(b) {
+				return time.Time{}, ErrSyntax
+			}
+			loc = fixedZone(sign * offset)
+		default:
+			return time.Time{}, ErrSyntax
+		}
+	}
+	if month < 1 || month > 12 || day < 1 || day > daysIn(month, year) || hour > 23 || min > 59 || sec > 60 {
+		return time.Time{}, ErrRange
+	}
+	return time.Date(year, time.Month(month), day, hour, min, sec, nsec, loc), nil
+}
+
+func daysIn(month, year int) int {
+	switch month {
+	case 2:
+		if year%4 == 0 && (year%100 != 0 || year%400 == 0) {
+			return 29
+		}
+		return 28
+	case 4, 6, 9, 11:
+		return 30
+	}
+	return 31
+}
+
+func AppendInt(dst []byte, v int64) []byte {
+	return strconv.AppendInt(dst, v, 10)
+}
+
+func AppendFloat(dst []byte, v float64) []byte {
+	return strconv.AppendFloat(dst, v, 'g', -1, 64)
+}
+
+func AppendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 't')
+	}
+	return append(dst, 'f')
+}
+
+// 格式为 2006-01-02 15:04:05.999999999-07:00, 与ParseTime对应
+func AppendTime(dst []byte, t time.Time) []byte {
+	return t.AppendFormat(dst, "2006-01-02 15:04:05.999999999-07:00")
+}
+
+// 将bytea的文本形式解码后追加到dst, 支持hex格式(\x...)和escape格式
+func DecodeBytea(dst, src []byte) ([]byte, error) {
+	if len(src) >= 2 && src[0] == '\\' && src[1] == 'x' {
+		src = src[2:]
+		if len(src)%2 != 0 {
+			return dst, ErrSyntax
+		}
+		for i := 0; i < len(src); i += 2 {
+			hi, ok1 := unhex(src[i])
+			lo, ok2 := unhex(src[i+1])
+			if !ok1 || !ok2 {
+				return dst, ErrSyntax
+			}
+			dst = append(dst, hi<<4|lo)
+		}
+		return dst, nil
+	}
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if c != '\\' {
+			dst = append(dst, c)
+			continue
+		}
+		if i+1 < len(src) && src[i+1] == '\\' {
+			dst = append(dst, '\\')
+			i++
+			continue
+		}
+		if i+3 >= len(src) {
+			return dst, ErrSyntax
+		}
+		var v int
+		for _, o := range src[i+1 : i+4] {
+			if o < '0' || o > '7' {
+				return dst, ErrSyntax
+			}
+			v = v*8 + int(o-'0')
+		}
+		if v > 0xff {
+			return dst, ErrSyntax
+		}
+		dst = append(dst, byte(v))
+		i += 3
+	}
+	return dst, nil
+}
+
+func AppendByteaHex(dst, b []byte) []byte {
+	dst = append(dst, '\\', 'x')
+	const digits = "0123456789abcdef"
+	for _, c := range b {
+		dst = append(dst, digits[c>>4], digits[c&0xf])
+	}
+	return dst
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
@@ -0,0 +1,129 @@
+package textcodec
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		in   string
+		bits int
+		want int64
+		err  error
+	}{
+		{"0", 64, 0, nil},
+		{"-42", 64, -42, nil},
+		{"+7", 64, 7, nil},
+		{"9223372036854775807", 64, 9223372036854775807, nil},
+		{"-9223372036854775808", 64, -9223372036854775808, nil},
+		{"9223372036854775808", 64, 9223372036854775807, ErrRange},
+		{"-129", 8, -128, ErrRange},
+		{"127", 8, 127, nil},
+		{"", 64, 0, ErrSyntax},
+		{"-", 64, 0, ErrSyntax},
+		{"1x", 64, 0, ErrSyntax},
+	}
+	for _, tt := range tests {
+		got, err := ParseInt([]byte(tt.in), tt.bits)
+		if got != tt.want || err != tt.err {
+			t.Errorf("ParseInt(%q, %d) = %d, %v; want %d, %v", tt.in, tt.bits, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024-03-05", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"2024-02-29", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"2024-03-05 10:20:30", time.Date(2024, 3, 5, 10, 20, 30, 0, time.UTC)},
+		{"2024-03-05T10:20:30.123456Z", time.Date(2024, 3, 5, 10, 20, 30, 123456000, time.UTC)},
+		{"2024-03-05 10:20:30+08", time.Date(2024, 3, 5, 2, 20, 30, 0, time.UTC)},
+		{"2024-03-05 10:20:30-05:30", time.Date(2024, 3, 5, 15, 50, 30, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime([]byte(tt.in), nil)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "2024-3-05", "2024-03-05 10:20", "2024-03-05 10:20:30.", "2024-03-05 10:20:30+8", "2024-02-30", "2023-02-29", "1900-02-29", "2024-04-31"} {
+		if _, err := ParseTime([]byte(in), nil); err == nil {
+			t.Errorf("ParseTime(%q) succeeded; want error", in)
+		}
+	}
+	ts := time.Date(2024, 3, 5, 10, 20, 30, 500, time.FixedZone("", 3600))
+	got, err := ParseTime(AppendTime(nil, ts), nil)
+	if err != nil || !got.Equal(ts) {
+		t.Errorf("round trip %v = %v, %v", ts, got, err)
+	}
+}
+
+func TestParseBool(t *testing.T) {
+	for _, in := range []string{"t", "TRUE", "True", "1", "Y", "yes", "YES", "On"} {
+		if v, err := ParseBool([]byte(in)); !v || err != nil {
+			t.Errorf("ParseBool(%q) = %v, %v; want true", in, v, err)
+		}
+	}
+	for _, in := range []string{"f", "FALSE", "0", "N", "No", "OFF"} {
+		if v, err := ParseBool([]byte(in)); v || err != nil {
+			t.Errorf("ParseBool(%q) = %v, %v; want false", in, v, err)
+		}
+	}
+	for _, in := range []string{"", "2", "yess", "enabled"} {
+		if _, err := ParseBool([]byte(in)); err != ErrSyntax {
+			t.Errorf("ParseBool(%q) err = %v; want ErrSyntax", in, err)
+		}
+	}
+}
+
+func TestDecodeBytea(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []byte
+	}{
+		{`\x`, []byte{}},
+		{`\x00ff10`, []byte{0x00, 0xff, 0x10}},
+		{`abc`, []byte("abc")},
+		{`a\\b\000\377`, []byte{'a', '\\', 'b', 0, 0xff}},
+	}
+	for _, tt := range tests {
+		got, err := DecodeBytea(nil, []byte(tt.in))
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("DecodeBytea(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{`\x0`, `\xzz`, `\12`, `\400`} {
+		if _, err := DecodeBytea(nil, []byte(in)); err == nil {
+			t.Errorf("DecodeBytea(%q) succeeded; want error", in)
+		}
+	}
+	b := []byte{0, 1, 0xab}
+	if got, _ := DecodeBytea(nil, AppendByteaHex(nil, b)); !bytes.Equal(got, b) {
+		t.Errorf("hex round trip = %v; want %v", got, b)
+	}
+}
+
+func TestAllocs(t *testing.T) {
+	in := []byte("2024-03-05 10:20:30.5+08:00")
+	num := []byte("-12345")
+	flt := []byte("3.25")
+	buf := make([]byte, 0, 64)
+	ParseTime(in, nil)
+	n := testing.AllocsPerRun(100, func() {
+		ParseInt(num, 64)
+		ParseFloat(flt, 64)
+		ParseBool([]byte("t"))
+		ParseTime(in, nil)
+		buf = AppendInt(buf[:0], -12345)
+		buf = AppendTime(buf[:0], time.Time{})
+		buf, _ = DecodeBytea(buf[:0], []byte(`\x0102`))
+	})
+	if n != 0 {
+		t.Errorf("got %v allocs; want 0", n)
+	}
+}
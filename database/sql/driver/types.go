@@ -2,8 +2,11 @@ package driver
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -81,6 +84,226 @@ func (int32Type) ConvertValue(v interface{}) (Value, error) {
 	return nil, fmt.Errorf("sql/driver: unsupported value %v (type %T) converting to int32", v, v)
 }
 
+var Int64 int64Type
+type int64Type struct{}
+func (int64Type) ConvertValue(v interface{}) (Value, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u64 := rv.Uint()
+		if u64 > math.MaxInt64 {
+			return nil, fmt.Errorf("sql/driver: value %d overflows int64", v)
+		}
+		return int64(u64), nil
+	case reflect.String:
+		i, err := strconv.ParseInt(rv.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("sql/driver: value %q can't be converted to int64", v)
+		}
+		return i, nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			i, err := strconv.ParseInt(string(rv.Bytes()), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("sql/driver: value %q can't be converted to int64", v)
+			}
+			return i, nil
+		}
+	}
+	return nil, fmt.Errorf("sql/driver: unsupported value %v (type %T) converting to int64", v, v)
+}
+
+var Float32 = floatType{bits: 32}
+var Float64 = floatType{bits: 64}
+type floatType struct {
+	bits int
+}
+func (f floatType) ConvertValue(v interface{}) (Value, error) {
+	var f64 float64
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f64 = rv.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		f64 = float64(i)
+		// 超过2^53的整数不一定能精确表示
+		if f64 >= 1<<63 || int64(f64) != i {
+			return nil, fmt.Errorf("sql/driver: value %v can't be represented exactly as float%d", v, f.bits)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		f64 = float64(u)
+		if f64 >= 1<<64 || uint64(f64) != u {
+			return nil, fmt.Errorf("sql/driver: value %v can't be represented exactly as float%d", v, f.bits)
+		}
+	case reflect.String:
+		var err error
+		f64, err = strconv.ParseFloat(rv.String(), f.bits)
+		if err != nil {
+			return nil, fmt.Errorf("sql/driver: value %q can't be converted to float%d", v, f.bits)
+		}
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, fmt.Errorf("sql/driver: unsupported value %v (type %T) converting to float%d", v, v, f.bits)
+		}
+		var err error
+		f64, err = strconv.ParseFloat(string(rv.Bytes()), f.bits)
+		if err != nil {
+			return nil, fmt.Errorf("sql/driver: value %q can't be converted to float%d", v, f.bits)
+		}
+	default:
+		return nil, fmt.Errorf("sql/driver: unsupported value %v (type %T) converting to float%d", v, v, f.bits)
+	}
+	if f.bits == 32 && !math.IsInf(f64, 0) && math.Abs(f64) > math.MaxFloat32 {
+		return nil, fmt.Errorf("sql/driver: value %v overflows float32", v)
+	}
+	if f.bits == 32 && !math.IsNaN(f64) && float64(float32(f64)) != f64 {
+		return nil, fmt.Errorf("sql/driver: value %v can't be represented exactly as float32", v)
+	}
+	return f64, nil
+}
+
+var Bytes bytesType
+type bytesType struct{}
+func (bytesType) ConvertValue(v interface{}) (Value, error) {
+	switch s := v.(type) {
+	case []byte:
+		return s, nil
+	case string:
+		return []byte(s), nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(rv.String()), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("sql/driver: unsupported value %v (type %T) converting to bytes", v, v)
+}
+
+// Time能够解析的文本格式, 按顺序尝试
+var TimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+var Time timeType
+type timeType struct{}
+func (timeType) ConvertValue(v interface{}) (Value, error) {
+	switch s := v.(type) {
+	case time.Time:
+		return s, nil
+	case *time.Time:
+		if s == nil {
+			return nil, fmt.Errorf("sql/driver: nil *time.Time can't be converted to time")
+		}
+		return *s, nil
+	case string:
+		return parseTime(s)
+	case []byte:
+		return parseTime(string(s))
+	}
+	return nil, fmt.Errorf("sql/driver: unsupported value %v (type %T) converting to time", v, v)
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range TimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("sql/driver: value %q can't be converted to time", s)
+}
+
+// 定点数转换器, 结果为规范化后的十进制字符串
+// Precision为总有效位数, Scale为小数位数, Precision为0表示不限制整数位数;
+// 零值Decimal{}不限制位数, 只检查格式并规范化
+type Decimal struct {
+	Precision int
+	Scale int
+}
+func (d Decimal) ConvertValue(v interface{}) (Value, error) {
+	var s string
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("sql/driver: value %v can't be converted to decimal", v)
+		}
+		s = strconv.FormatFloat(f, 'f', -1, rv.Type().Bits())
+	case reflect.String:
+		s = rv.String()
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, fmt.Errorf("sql/driver: unsupported value %v (type %T) converting to decimal", v, v)
+		}
+		s = string(rv.Bytes())
+	default:
+		return nil, fmt.Errorf("sql/driver: unsupported value %v (type %T) converting to decimal", v, v)
+	}
+	return d.normalize(s)
+}
+
+func (d Decimal) normalize(s string) (Value, error) {
+	neg := false
+	t := s
+	if len(t) > 0 && (t[0] == '-' || t[0] == '+') {
+		neg = t[0] == '-'
+		t = t[1:]
+	}
+	intPart, fracPart := t, ""
+	if i := strings.IndexByte(t, '.'); i >= 0 {
+		intPart, fracPart = t[:i], t[i+1:]
+	}
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return nil, fmt.Errorf("sql/driver: value %q can't be converted to decimal", s)
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	fracPart = strings.TrimRight(fracPart, "0")
+	if d != (Decimal{}) && len(fracPart) > d.Scale {
+		return nil, fmt.Errorf("sql/driver: value %q exceeds decimal scale %d", s, d.Scale)
+	}
+	if d.Precision > 0 && len(intPart) > d.Precision-d.Scale {
+		return nil, fmt.Errorf("sql/driver: value %q overflows decimal(%d,%d)", s, d.Precision, d.Scale)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	out := intPart
+	if fracPart != "" {
+		out += "." + fracPart
+	}
+	if neg && out != "0" {
+		out = "-" + out
+	}
+	return out, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 var String stringType
 type stringType struct{}
 func (stringType) ConvertValue(v interface{}) (Value, error) {
@@ -136,54 +359,185 @@ func callValuerValue(vr Valuer) (v Value, err error) {
 	return vr.Value()
 }
 
-var DefaultParameterConverter defaultConverter
-type defaultConverter struct{}
-func (defaultConverter) ConvertValue(v interface{}) (Value, error) {
+// 驱动额外支持的原生值类型, 如decimal、UUID、JSON或数组类型
+type ValueTypes struct {
+	types map[reflect.Type]struct{}
+	// 切片和数组参数的编码方式, 为nil时不支持除[]byte外的切片
+	Arrays ArrayEncoder
+}
+
+func NewValueTypes(types ...reflect.Type) *ValueTypes {
+	vt := &ValueTypes{types: make(map[reflect.Type]struct{}, len(types))}
+	for _, t := range types {
+		vt.types[t] = struct{}{}
+	}
+	return vt
+}
+
+func (vt *ValueTypes) IsValue(v interface{}) bool {
 	if IsValue(v) {
+		return true
+	}
+	if vt == nil || v == nil {
+		return false
+	}
+	_, ok := vt.types[reflect.TypeOf(v)]
+	return ok
+}
+
+func (vt *ValueTypes) IsScanValue(v interface{}) bool {
+	return vt.IsValue(v)
+}
+
+// 对已注册的类型原样传递, 其余与DefaultParameterConverter一致
+func (vt *ValueTypes) ParameterConverter() ValueConverter {
+	return defaultConverter{native: vt}
+}
+
+// 除已注册的类型外, uint64也原样传递, 不再拒绝最高位为1的值
+func (vt *ValueTypes) Uint64ParameterConverter() ValueConverter {
+	return defaultConverter{native: vt, uint64: true}
+}
+
+// 由Conn实现, 声明该驱动支持的额外原生值类型
+type ValueTypesProvider interface {
+	ValueTypes() *ValueTypes
+}
+
+var DefaultParameterConverter defaultConverter
+type defaultConverter struct{
+	native *ValueTypes
+	uint64 bool
+}
+func (c defaultConverter) ConvertValue(v interface{}) (Value, error) {
+	if c.native != nil && len(c.native.types) > 0 {
+		if _, ok := c.native.types[reflect.TypeOf(v)]; ok {
+			return v, nil
+		}
+	}
+	// 内置类型直接走类型断言, 不使用反射
+	switch s := v.(type) {
+	case nil, int64, float64, bool, string, []byte, time.Time:
 		return v, nil
+	case int:
+		return int64(s), nil
+	case int8:
+		return int64(s), nil
+	case int16:
+		return int64(s), nil
+	case int32:
+		return int64(s), nil
+	case uint:
+		return int64(s), nil
+	case uint8:
+		return int64(s), nil
+	case uint16:
+		return int64(s), nil
+	case uint32:
+		return int64(s), nil
+	case uint64:
+		return c.convertUint64(s)
+	case float32:
+		return float64(s), nil
 	}
 	if vr, ok := v.(Valuer); ok {
 		sv, err := callValuerValue(vr)
 		if err != nil {
 			return nil, err
 		}
-		if !IsValue(sv) {
+		if u64, ok := sv.(uint64); ok {
+			return c.convertUint64(u64)
+		}
+		if !c.native.IsValue(sv) {
 			return nil, fmt.Errorf("non-Value type %T returned from value", sv)
 		}
 		return sv, nil
 	}
 	rv := reflect.ValueOf(v)
-	switch rv.Kind() {
+	return kindConverterFor(rv.Type())(c, rv)
+}
+
+func (c defaultConverter) convertUint64(u64 uint64) (Value, error) {
+	if c.uint64 {
+		return u64, nil
+	}
+	if u64 >= 1<<63 {
+		return nil, fmt.Errorf("uint64 values with high bit set are not supported")
+	}
+	return int64(u64), nil
+}
+
+type kindConverter func(c defaultConverter, rv reflect.Value) (Value, error)
+
+// 按类型缓存命名类型(如 type UserID int64)的转换函数
+var kindConverters sync.Map
+
+func kindConverterFor(t reflect.Type) kindConverter {
+	if fn, ok := kindConverters.Load(t); ok {
+		return fn.(kindConverter)
+	}
+	fn := newKindConverter(t)
+	kindConverters.Store(t, fn)
+	return fn
+}
+
+func newKindConverter(t reflect.Type) kindConverter {
+	switch t.Kind() {
 	case reflect.Ptr:
-		if rv.IsNil() {
-			return nil, nil
-		} else {
-			return defaultConverter{}.ConvertValue(rv.Elem().Interface())
+		return func(c defaultConverter, rv reflect.Value) (Value, error) {
+			if rv.IsNil() {
+				return nil, nil
+			}
+			return c.ConvertValue(rv.Elem().Interface())
 		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return rv.Int(), nil
+		return func(c defaultConverter, rv reflect.Value) (Value, error) {
+			return rv.Int(), nil
+		}
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
-		return int64(rv.Uint()), nil
+		return func(c defaultConverter, rv reflect.Value) (Value, error) {
+			return int64(rv.Uint()), nil
+		}
 	case reflect.Uint64:
-		u64 := rv.Uint()
-		if u64 >= 1<<63 {
-			return nil, fmt.Errorf("uint64 values with high bit set are not supported")
+		return func(c defaultConverter, rv reflect.Value) (Value, error) {
+			return c.convertUint64(rv.Uint())
 		}
-		return int64(u64), nil
 	case reflect.Float32, reflect.Float64:
-		return rv.Float(), nil
+		return func(c defaultConverter, rv reflect.Value) (Value, error) {
+			return rv.Float(), nil
+		}
 	case reflect.Bool:
-		return rv.Bool(), nil
+		return func(c defaultConverter, rv reflect.Value) (Value, error) {
+			return rv.Bool(), nil
+		}
+	case reflect.String:
+		return func(c defaultConverter, rv reflect.Value) (Value, error) {
+			return rv.String(), nil
+		}
 	case reflect.Slice:
-		ek := rv.Type().Elem().Kind()
+		ek := t.Elem().Kind()
 		if ek == reflect.Uint8 {
-			return rv.Bytes(), nil
+			return func(c defaultConverter, rv reflect.Value) (Value, error) {
+				return rv.Bytes(), nil
+			}
 		}
-		return nil, fmt.Errorf("unsupported type %T, a slice of %s", v, ek)
-	case reflect.String:
-		return rv.String(), nil
+		return func(c defaultConverter, rv reflect.Value) (Value, error) {
+			if c.native != nil && c.native.Arrays != nil {
+				return c.convertArray(rv)
+			}
+			return nil, fmt.Errorf("unsupported type %s, a slice of %s", t, ek)
+		}
+	case reflect.Array:
+		return func(c defaultConverter, rv reflect.Value) (Value, error) {
+			if c.native != nil && c.native.Arrays != nil {
+				return c.convertArray(rv)
+			}
+			return nil, fmt.Errorf("unsupported type %s, a %s", t, t.Kind())
+		}
+	}
+	return func(c defaultConverter, rv reflect.Value) (Value, error) {
+		return nil, fmt.Errorf("unsupported type %s, a %s", t, t.Kind())
 	}
-	return nil, fmt.Errorf("unsupported type %T, a %s", v, rv.Kind())
 }
 
 
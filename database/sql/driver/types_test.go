@@ -77,3 +77,188 @@ func TestValueConverters(t *testing.T) {
 
 
 
+
+var convertersTests = []valueConverterTest{
+	{Int64, int32(-7), int64(-7), ""},
+	{Int64, uint64(1 << 63), nil, "sql/driver: value 9223372036854775808 overflows int64"},
+	{Int64, "42", int64(42), ""},
+	{Int64, []byte("42"), int64(42), ""},
+	{Int64, "4x", nil, "sql/driver: value \"4x\" can't be converted to int64"},
+	{Float32, float64(1e39), nil, "sql/driver: value 1e+39 overflows float32"},
+	{Float32, "1.5", float64(1.5), ""},
+	{Float64, int64(3), float64(3), ""},
+	{Float64, []byte("2.25"), float64(2.25), ""},
+	{Float64, int64(1<<53 + 1), nil, "sql/driver: value 9007199254740993 can't be represented exactly as float64"},
+	{Float64, uint64(1<<63), float64(1 << 63), ""},
+	{Float32, int32(1<<24 + 1), nil, "sql/driver: value 16777217 can't be represented exactly as float32"},
+	{Float32, 0.1, nil, "sql/driver: value 0.1 can't be represented exactly as float32"},
+	{Float32, float32(0.1), float64(float32(0.1)), ""},
+	{Bytes, "ab", []byte("ab"), ""},
+	{Bytes, bs{1, 2}, []byte{1, 2}, ""},
+	{Bytes, 1, nil, "sql/driver: unsupported value 1 (type int) converting to bytes"},
+	{Time, "2019-03-04T05:06:07Z", time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC), ""},
+	{Time, []byte("2019-03-04 05:06:07.5"), time.Date(2019, 3, 4, 5, 6, 7, 5e8, time.UTC), ""},
+	{Time, "2019-03-04", time.Date(2019, 3, 4, 0, 0, 0, 0, time.UTC), ""},
+	{Time, "yesterday", nil, "sql/driver: value \"yesterday\" can't be converted to time"},
+	{Decimal{Precision: 5, Scale: 2}, "012.50", "12.5", ""},
+	{Decimal{Precision: 5, Scale: 2}, -0.25, "-0.25", ""},
+	{Decimal{Precision: 5, Scale: 2}, 1234, nil, "sql/driver: value \"1234\" overflows decimal(5,2)"},
+	{Decimal{Precision: 5, Scale: 2}, "1.234", nil, "sql/driver: value \"1.234\" exceeds decimal scale 2"},
+	{Decimal{}, "-001.2500", "-1.25", ""},
+	{Decimal{Precision: 3}, "1.5", nil, "sql/driver: value \"1.5\" exceeds decimal scale 0"},
+	{Decimal{Scale: 0}, "1e3", nil, "sql/driver: value \"1e3\" can't be converted to decimal"},
+}
+
+func TestTypedConverters(t *testing.T) {
+	for _, vct := range convertersTests {
+		out, err := vct.c.ConvertValue(vct.in)
+		var errStr string
+		if err != nil {
+			errStr = err.Error()
+		}
+		if errStr != vct.err {
+			t.Errorf("%T(%T(%v)) error = %q; want error = %q", vct.c, vct.in, vct.in, errStr, vct.err)
+			continue
+		}
+		if vct.err != "" {
+			continue
+		}
+		if !reflect.DeepEqual(out, vct.out) {
+			t.Errorf("%T(%T(%v)) = %v (%T); want %v (%T)", vct.c, vct.in, vct.in, out, out, vct.out, vct.out)
+		}
+	}
+}
+
+type uuid [16]byte
+
+func TestValueTypesParameterConverter(t *testing.T) {
+	vt := NewValueTypes(reflect.TypeOf(uuid{}))
+	id := uuid{1, 2, 3}
+	out, err := vt.ParameterConverter().ConvertValue(&id)
+	if err != nil || out != id {
+		t.Errorf("ConvertValue(%v) = %v, %v; want %v", id, out, err, id)
+	}
+	if _, err := DefaultParameterConverter.ConvertValue(id); err == nil {
+		t.Errorf("DefaultParameterConverter accepted unregistered type %T", id)
+	}
+	if !vt.IsScanValue(id) || IsScanValue(id) {
+		t.Errorf("IsScanValue mismatch for registered type %T", id)
+	}
+}
+
+func TestUint64ParameterConverter(t *testing.T) {
+	type id uint64
+	var vt *ValueTypes
+	out, err := vt.Uint64ParameterConverter().ConvertValue(id(1 << 63))
+	if err != nil || out != uint64(1<<63) {
+		t.Errorf("ConvertValue(id(1<<63)) = %v (%T), %v; want uint64(1<<63)", out, out, err)
+	}
+	if _, err := DefaultParameterConverter.ConvertValue(uint64(1 << 63)); err == nil {
+		t.Error("DefaultParameterConverter accepted uint64 with high bit set")
+	}
+	out, err = vt.Uint64ParameterConverter().ConvertValue(uint64Valuer(1 << 63))
+	if err != nil || out != uint64(1<<63) {
+		t.Errorf("ConvertValue(Valuer returning uint64(1<<63)) = %v (%T), %v; want uint64(1<<63)", out, out, err)
+	}
+	out, err = DefaultParameterConverter.ConvertValue(uint64Valuer(7))
+	if err != nil || out != int64(7) {
+		t.Errorf("ConvertValue(Valuer returning uint64(7)) = %v (%T), %v; want int64(7)", out, out, err)
+	}
+	if _, err := DefaultParameterConverter.ConvertValue(uint64Valuer(1 << 63)); err == nil {
+		t.Error("DefaultParameterConverter accepted Valuer returning uint64 with high bit set")
+	}
+}
+
+type uint64Valuer uint64
+
+func (v uint64Valuer) Value() (Value, error) {
+	return uint64(v), nil
+}
+
+func TestArrayEncoders(t *testing.T) {
+	at := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	tests := []struct {
+		enc ArrayEncoder
+		in interface{}
+		out interface{}
+	}{
+		{PostgresArray, []int64{1, -2}, "{1,-2}"},
+		{PostgresArray, []string{`a"b`, `c\d`}, `{"a\"b","c\\d"}`},
+		{PostgresArray, []*float64{nil}, "{NULL}"},
+		{PostgresArray, []time.Time{at}, `{"2019-03-04T05:06:07Z"}`},
+		{JSONArray, []float64{1.5, 2}, []byte("[1.5,2]")},
+		{JSONArray, [2]bool{true, false}, []byte("[true,false]")},
+		{NativeArray, is{1, 2}, []Value{int64(1), int64(2)}},
+		{PostgresArray, [][2]byte{{0xab, 0xcd}}, `{"\\xabcd"}`},
+		{NativeArray, []uuid{{15: 1}}, []Value{[]byte{15: 1}}},
+		{JSONArray, [][]byte{[]byte("a")}, []byte(`["YQ=="]`)},
+	}
+	for _, tt := range tests {
+		vt := NewValueTypes()
+		vt.Arrays = tt.enc
+		out, err := vt.ParameterConverter().ConvertValue(tt.in)
+		if err != nil || !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("%T.ConvertValue(%v) = %v, %v; want %v", tt.enc, tt.in, out, err, tt.out)
+		}
+	}
+}
+
+func TestArrayEncodersRejectNested(t *testing.T) {
+	for _, enc := range []ArrayEncoder{PostgresArray, JSONArray, NativeArray} {
+		vt := NewValueTypes()
+		vt.Arrays = enc
+		for _, in := range []interface{}{[][]int64{{1}}, [][2]string{{"a", "b"}}, []interface{}{1, []int{2}}} {
+			if out, err := vt.ParameterConverter().ConvertValue(in); err == nil {
+				t.Errorf("%T.ConvertValue(%v) = %v; want an error for nested arrays", enc, in, out)
+			}
+		}
+	}
+}
+
+type userID int64
+
+// 本身就是driver.Value的参数原样返回, 不应分配
+var passThroughConversions = []interface{}{
+	int64(1 << 40),
+	"hello",
+	now,
+	[]byte("hello"),
+}
+
+// 其余整数类型需要装箱为int64, 只允许这一次分配; 数值都大于255, 避开运行时对小整数的装箱缓存
+var boxedConversions = []interface{}{
+	int(1 << 20),
+	int32(-70000),
+	uint32(1 << 30),
+	userID(1 << 40),
+}
+
+func TestDefaultParameterConverterAllocs(t *testing.T) {
+	check := func(vs []interface{}, want float64) {
+		for _, v := range vs {
+			allocs := testing.AllocsPerRun(100, func() {
+				DefaultParameterConverter.ConvertValue(v)
+			})
+			if allocs != want {
+				t.Errorf("ConvertValue(%T(%v)) allocates %v times; want %v", v, v, allocs, want)
+			}
+		}
+	}
+	check(passThroughConversions, 0)
+	check(boxedConversions, 1)
+}
+
+func benchmarkConvertValue(b *testing.B, v interface{}) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		DefaultParameterConverter.ConvertValue(v)
+	}
+}
+
+func BenchmarkConvertValueInt64(b *testing.B) { benchmarkConvertValue(b, int64(1<<40)) }
+func BenchmarkConvertValueString(b *testing.B) { benchmarkConvertValue(b, "hello") }
+func BenchmarkConvertValueTime(b *testing.B) { benchmarkConvertValue(b, now) }
+func BenchmarkConvertValueInt(b *testing.B) { benchmarkConvertValue(b, int(1<<20)) }
+func BenchmarkConvertValueNamedInt(b *testing.B) { benchmarkConvertValue(b, userID(1<<40)) }
+func BenchmarkConvertValueNamedString(b *testing.B) { benchmarkConvertValue(b, s("a")) }
+func BenchmarkConvertValuePointer(b *testing.B) { benchmarkConvertValue(b, &answer) }
@@ -0,0 +1,76 @@
+package sql
+
+import "github.com/dimdark/gdk/database/sql/driver"
+
+const (
+	stateUniqueViolation = "23505"
+	stateForeignKeyViolation = "23503"
+	stateNotNullViolation = "23502"
+	stateCheckViolation = "23514"
+	stateSerializationFailure = "40001"
+	stateDeadlock = "40P01"
+)
+
+type Error = driver.Error
+
+// 沿着错误链查找驱动返回的结构化错误
+func AsError(err error) (Error, bool) {
+	for err != nil {
+		if de, ok := err.(driver.Error); ok {
+			return de, true
+		}
+		switch e := err.(type) {
+		case *BatchError:
+			err = e.Err
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func SQLState(err error) string {
+	if de, ok := AsError(err); ok {
+		return de.SQLState()
+	}
+	return ""
+}
+
+func SQLStateClass(err error) string {
+	state := SQLState(err)
+	if len(state) < 2 {
+		return ""
+	}
+	return state[:2]
+}
+
+func IsUniqueViolation(err error) bool {
+	return SQLState(err) == stateUniqueViolation
+}
+
+func IsForeignKeyViolation(err error) bool {
+	return SQLState(err) == stateForeignKeyViolation
+}
+
+func IsNotNullViolation(err error) bool {
+	return SQLState(err) == stateNotNullViolation
+}
+
+func IsCheckViolation(err error) bool {
+	return SQLState(err) == stateCheckViolation
+}
+
+func IsIntegrityViolation(err error) bool {
+	return SQLStateClass(err) == "23"
+}
+
+// 只识别SQLSTATE 40P01; 其它数据库的死锁(如MySQL的1213)由驱动通过自己的错误码报告
+func IsDeadlock(err error) bool {
+	return SQLState(err) == stateDeadlock
+}
+
+func IsSerializationFailure(err error) bool {
+	return SQLState(err) == stateSerializationFailure
+}
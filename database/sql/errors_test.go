@@ -0,0 +1,32 @@
+package sql
+
+import "testing"
+
+type stateError string
+
+func (e stateError) Error() string      { return "sqlstate " + string(e) }
+func (e stateError) SQLState() string   { return string(e) }
+func (e stateError) Severity() string   { return "ERROR" }
+func (e stateError) Constraint() string { return "" }
+func (e stateError) Table() string      { return "" }
+func (e stateError) Column() string     { return "" }
+
+func TestIsDeadlock(t *testing.T) {
+	tests := []struct {
+		state string
+		deadlock, serialization bool
+	}{
+		{"40P01", true, false}, // PostgreSQL
+		{"40001", false, true},
+		{"23505", false, false},
+	}
+	for _, tt := range tests {
+		err := stateError(tt.state)
+		if got := IsDeadlock(err); got != tt.deadlock {
+			t.Errorf("IsDeadlock(%s) = %v; want %v", tt.state, got, tt.deadlock)
+		}
+		if got := IsSerializationFailure(err); got != tt.serialization {
+			t.Errorf("IsSerializationFailure(%s) = %v; want %v", tt.state, got, tt.serialization)
+		}
+	}
+}
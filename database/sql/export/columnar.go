@@ -0,0 +1,166 @@
+package export
+
+import (
+	"encoding/binary"
+	"github.com/dimdark/gdk/database/sql"
+	"github.com/dimdark/gdk/io"
+	"math"
+	"time"
+)
+
+// 列式格式的版本号
+//
+// 文件以"GDKC"和1字节版本号开头, 随后是列头: 列数, 每列的列名、数据库类型名和1字节类型标记.
+// 之后是若干行组, 每组以行数开头, 接着依次是每一列的数据块:
+// 块长度, 空值位图(每行1bit, 置位表示NULL), 以及按行顺序排列的非NULL值.
+// 行数为0的行组表示结束. 整数和长度均使用varint编码, 字符串和二进制值为长度加内容,
+// 浮点数为8字节小端序, 布尔值为1字节, 时间为UTC的秒数(varint)加纳秒数(uvarint),
+// 类型未知的列按文本形式存为字符串.
+const ColumnarVersion = 1
+
+const columnarMagic = "GDKC"
+
+// 列式格式中的列类型标记
+const (
+	ColumnString byte = iota + 1
+	ColumnInt
+	ColumnUint
+	ColumnFloat
+	ColumnBool
+	ColumnTime
+	ColumnBytes
+)
+
+var columnTags = map[kind]byte{
+	kindAny: ColumnString,
+	kindString: ColumnString,
+	kindInt: ColumnInt,
+	kindUint: ColumnUint,
+	kindFloat: ColumnFloat,
+	kindBool: ColumnBool,
+	kindTime: ColumnTime,
+	kindBytes: ColumnBytes,
+}
+
+const defaultGroupSize = 4096
+
+// 将rows写为列式格式, 每groupSize行为一个行组, groupSize<=0时使用默认值
+func WriteColumnar(w io.Writer, rows *sql.Rows, groupSize int) (int64, error) {
+	if groupSize <= 0 {
+		groupSize = defaultGroupSize
+	}
+	s, err := newScanner(rows)
+	if err != nil {
+		return 0, err
+	}
+	buf := append([]byte(columnarMagic), ColumnarVersion)
+	buf = appendUvarint(buf, uint64(len(s.names)))
+	for i, name := range s.names {
+		buf = appendString(buf, name)
+		buf = appendString(buf, s.dbTypes[i])
+		buf = append(buf, columnTags[s.kinds[i]])
+	}
+	if err := write(w, buf); err != nil {
+		return 0, err
+	}
+
+	cols := make([][]byte, len(s.names))
+	nulls := make([][]byte, len(s.names))
+	var n int64
+	rowsInGroup := 0
+	flush := func() error {
+		buf = appendUvarint(buf[:0], uint64(rowsInGroup))
+		for i := range cols {
+			bitmap := nulls[i][:(rowsInGroup+7)/8]
+			buf = appendUvarint(buf, uint64(len(bitmap)+len(cols[i])))
+			buf = append(buf, bitmap...)
+			buf = append(buf, cols[i]...)
+			cols[i] = cols[i][:0]
+			for j := range nulls[i] {
+				nulls[i][j] = 0
+			}
+		}
+		rowsInGroup = 0
+		return write(w, buf)
+	}
+	for {
+		ok, err := s.next()
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			break
+		}
+		for i := range cols {
+			if len(nulls[i]) < (rowsInGroup+8)/8 {
+				nulls[i] = append(nulls[i], 0)
+			}
+			v := s.value(i)
+			if v == nil {
+				nulls[i][rowsInGroup/8] |= 1 << uint(rowsInGroup%8)
+				continue
+			}
+			if s.kinds[i] == kindAny {
+				// 列头标记为ColumnString, 无论驱动返回的是什么类型都按文本写
+				cols[i] = appendString(cols[i], string(appendText(nil, v)))
+				continue
+			}
+			cols[i] = appendColumnValue(cols[i], v)
+		}
+		rowsInGroup++
+		n++
+		if rowsInGroup == groupSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if rowsInGroup > 0 {
+		if err := flush(); err != nil {
+			return n, err
+		}
+	}
+	return n, write(w, appendUvarint(buf[:0], 0))
+}
+
+func appendColumnValue(dst []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case int64:
+		return appendVarint(dst, v)
+	case uint64:
+		return appendUvarint(dst, v)
+	case float64:
+		var tmp [8]byte
+		binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(v))
+		return append(dst, tmp[:]...)
+	case bool:
+		if v {
+			return append(dst, 1)
+		}
+		return append(dst, 0)
+	case time.Time:
+		dst = appendVarint(dst, v.Unix())
+		return appendUvarint(dst, uint64(v.Nanosecond()))
+	case sql.RawBytes:
+		dst = appendUvarint(dst, uint64(len(v)))
+		return append(dst, v...)
+	case string:
+		return appendString(dst, v)
+	}
+	return appendString(dst, string(appendText(nil, v)))
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
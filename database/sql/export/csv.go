@@ -0,0 +1,90 @@
+package export
+
+import (
+	"bytes"
+	"github.com/dimdark/gdk/database/sql"
+	"github.com/dimdark/gdk/io"
+)
+
+type CSVOptions struct {
+	// 字段分隔符, 默认为','
+	Comma byte
+	// NULL输出的文本, 默认为空字符串; 与之相同的非NULL值会加上引号以示区分
+	NullText string
+	// 不输出列名所在的首行
+	NoHeader bool
+	// 使用"\n"作为行结束符, 默认按RFC 4180使用"\r\n"
+	UseLF bool
+}
+
+// 按RFC 4180将rows写为CSV, opts为nil时使用默认选项
+func WriteCSV(w io.Writer, rows *sql.Rows, opts *CSVOptions) (int64, error) {
+	var o CSVOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Comma == 0 {
+		o.Comma = ','
+	}
+	eol := "\r\n"
+	if o.UseLF {
+		eol = "\n"
+	}
+	s, err := newScanner(rows)
+	if err != nil {
+		return 0, err
+	}
+	var buf, field []byte
+	if !o.NoHeader {
+		for i, name := range s.names {
+			if i > 0 {
+				buf = append(buf, o.Comma)
+			}
+			buf = appendCSVField(buf, []byte(name), o.Comma, false)
+		}
+		buf = append(buf, eol...)
+		if err := write(w, buf); err != nil {
+			return 0, err
+		}
+	}
+	var n int64
+	for {
+		ok, err := s.next()
+		if !ok || err != nil {
+			return n, err
+		}
+		buf = buf[:0]
+		for i := range s.names {
+			if i > 0 {
+				buf = append(buf, o.Comma)
+			}
+			v := s.value(i)
+			if v == nil {
+				buf = appendCSVField(buf, []byte(o.NullText), o.Comma, false)
+				continue
+			}
+			field = appendText(field[:0], v)
+			buf = appendCSVField(buf, field, o.Comma, string(field) == o.NullText)
+		}
+		buf = append(buf, eol...)
+		if err := write(w, buf); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// 包含分隔符、引号或换行的字段加上引号, 字段内的引号写为两个引号
+func appendCSVField(dst, field []byte, comma byte, quote bool) []byte {
+	if !quote && !bytes.ContainsAny(field, "\"\r\n") && bytes.IndexByte(field, comma) < 0 {
+		return append(dst, field...)
+	}
+	dst = append(dst, '"')
+	for _, c := range field {
+		if c == '"' {
+			dst = append(dst, '"')
+		}
+		dst = append(dst, c)
+	}
+	return append(dst, '"')
+}
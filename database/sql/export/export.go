@@ -0,0 +1,236 @@
+// 将*sql.Rows的查询结果导出为CSV、JSON Lines或简单的列式格式
+//
+// 各列的类型由Rows.ColumnTypes()推断, 二进制列(ScanType为[]byte或数据库类型名为
+// BLOB/BINARY/BYTEA一类)在CSV和JSON Lines中以标准base64编码输出.
+// 导出函数按行读取并写出, 不会关闭rows, 返回写出的行数.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dimdark/gdk/database/sql"
+	"github.com/dimdark/gdk/database/sql/driver/textcodec"
+	"github.com/dimdark/gdk/encoding/base64"
+	"github.com/dimdark/gdk/io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type kind byte
+
+const (
+	kindAny kind = iota
+	kindString
+	kindInt
+	kindUint
+	kindFloat
+	kindBool
+	kindTime
+	kindBytes
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	kindsByType = map[reflect.Type]kind{
+		reflect.TypeOf(sql.NullString{}): kindString,
+		reflect.TypeOf(sql.NullInt64{}): kindInt,
+		reflect.TypeOf(sql.NullUint64{}): kindUint,
+		reflect.TypeOf(sql.NullFloat64{}): kindFloat,
+		reflect.TypeOf(sql.NullBool{}): kindBool,
+		reflect.TypeOf(sql.RawBytes{}): kindBytes,
+		timeType: kindTime,
+	}
+	binaryTypeNames = []string{"BLOB", "BINARY", "BYTEA", "IMAGE"}
+)
+
+func kindOf(ct *sql.ColumnType) kind {
+	if t := ct.ScanType(); t != nil {
+		if k, ok := kindsByType[t]; ok {
+			return k
+		}
+		switch t.Kind() {
+		case reflect.String:
+			return kindString
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return kindInt
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return kindUint
+		case reflect.Float32, reflect.Float64:
+			return kindFloat
+		case reflect.Bool:
+			return kindBool
+		case reflect.Slice:
+			if t.Elem().Kind() == reflect.Uint8 {
+				return kindBytes
+			}
+		}
+	}
+	name := strings.ToUpper(ct.DatabaseTypeName())
+	for _, n := range binaryTypeNames {
+		if strings.Contains(name, n) {
+			return kindBytes
+		}
+	}
+	return kindAny
+}
+
+// 时间列的扫描目标, 驱动以文本返回时间时用textcodec解析
+type nullTime struct {
+	Time time.Time
+	Valid bool
+}
+
+func (n *nullTime) Scan(value interface{}) error {
+	n.Valid = value != nil
+	switch v := value.(type) {
+	case nil:
+		n.Time = time.Time{}
+		return nil
+	case time.Time:
+		n.Time = v
+		return nil
+	case []byte:
+		t, err := textcodec.ParseTime(v, nil)
+		n.Time = t
+		return err
+	case string:
+		t, err := textcodec.ParseTime([]byte(v), nil)
+		n.Time = t
+		return err
+	}
+	return errors.New("export: cannot scan " + reflect.TypeOf(value).String() + " into a time column")
+}
+
+// 按列类型为每行准备扫描目标
+type scanner struct {
+	rows *sql.Rows
+	names []string
+	dbTypes []string
+	kinds []kind
+	dest []interface{}
+}
+
+func newScanner(rows *sql.Rows) (*scanner, error) {
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	s := &scanner{
+		rows: rows,
+		names: make([]string, len(cts)),
+		dbTypes: make([]string, len(cts)),
+		kinds: make([]kind, len(cts)),
+		dest: make([]interface{}, len(cts)),
+	}
+	for i, ct := range cts {
+		s.names[i] = ct.Name()
+		s.dbTypes[i] = ct.DatabaseTypeName()
+		s.kinds[i] = kindOf(ct)
+		switch s.kinds[i] {
+		case kindString:
+			s.dest[i] = new(sql.NullString)
+		case kindInt:
+			s.dest[i] = new(sql.NullInt64)
+		case kindUint:
+			s.dest[i] = new(sql.NullUint64)
+		case kindFloat:
+			s.dest[i] = new(sql.NullFloat64)
+		case kindBool:
+			s.dest[i] = new(sql.NullBool)
+		case kindTime:
+			s.dest[i] = new(nullTime)
+		case kindBytes:
+			s.dest[i] = new(sql.RawBytes)
+		default:
+			s.dest[i] = new(interface{})
+		}
+	}
+	return s, nil
+}
+
+// 读取下一行, 没有更多行时返回false, 出错时返回错误
+func (s *scanner) next() (bool, error) {
+	if !s.rows.Next() {
+		return false, s.rows.Err()
+	}
+	return true, s.rows.Scan(s.dest...)
+}
+
+// 返回当前行第i列的值, 类型为nil, string, int64, uint64, float64, bool,
+// time.Time或sql.RawBytes之一
+func (s *scanner) value(i int) interface{} {
+	switch d := s.dest[i].(type) {
+	case *sql.NullString:
+		if d.Valid {
+			return d.String
+		}
+	case *sql.NullInt64:
+		if d.Valid {
+			return d.Int64
+		}
+	case *sql.NullUint64:
+		if d.Valid {
+			return d.Uint64
+		}
+	case *sql.NullFloat64:
+		if d.Valid {
+			return d.Float64
+		}
+	case *sql.NullBool:
+		if d.Valid {
+			return d.Bool
+		}
+	case *nullTime:
+		if d.Valid {
+			return d.Time
+		}
+	case *sql.RawBytes:
+		if *d != nil {
+			return *d
+		}
+	case *interface{}:
+		// 类型未知的列, 驱动返回的[]byte按文本处理
+		if b, ok := (*d).([]byte); ok {
+			return string(b)
+		}
+		return *d
+	}
+	return nil
+}
+
+func appendBase64(dst, b []byte) []byte {
+	n := len(dst)
+	dst = append(dst, make([]byte, base64.StdEncoding.EncodedLen(len(b)))...)
+	base64.StdEncoding.Encode(dst[n:], b)
+	return dst
+}
+
+// 值的文本形式, 用于CSV以及列式格式中类型未知的列
+func appendText(dst []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(dst, v...)
+	case int64:
+		return strconv.AppendInt(dst, v, 10)
+	case uint64:
+		return strconv.AppendUint(dst, v, 10)
+	case float64:
+		return strconv.AppendFloat(dst, v, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(dst, v)
+	case time.Time:
+		return v.AppendFormat(dst, time.RFC3339Nano)
+	case sql.RawBytes:
+		return appendBase64(dst, v)
+	case nil:
+		return dst
+	}
+	return append(dst, fmt.Sprint(v)...)
+}
+
+func write(w io.Writer, b []byte) error {
+	_, err := w.Write(b)
+	return err
+}
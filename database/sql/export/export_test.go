@@ -0,0 +1,183 @@
+package export
+
+import (
+	"context"
+	"github.com/dimdark/gdk/database/sql"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type buffer struct {
+	b []byte
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.b = append(b.b, p...)
+	return len(p), nil
+}
+
+type testRows struct {
+	names []string
+	types []reflect.Type
+	data [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return r.names }
+func (r *testRows) Close() error      { return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
+func (r *testRows) ColumnTypeScanType(i int) reflect.Type { return r.types[i] }
+
+// 每次查询都返回rows的一份拷贝
+type testConn struct {
+	driver.Conn
+	rows testRows
+}
+
+func (c *testConn) Close() error { return nil }
+func (c *testConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	rows := c.rows
+	return &rows, nil
+}
+
+type testConnector struct {
+	c *testConn
+}
+
+func (c testConnector) Connect(context.Context) (driver.Conn, error) { return c.c, nil }
+func (c testConnector) Driver() driver.Driver                        { return nil }
+
+var (
+	int64Type = reflect.TypeOf(int64(0))
+	stringType = reflect.TypeOf("")
+	bytesType = reflect.TypeOf([]byte(nil))
+	anyType = reflect.TypeOf((*interface{})(nil)).Elem()
+	float64Type = reflect.TypeOf(float64(0))
+)
+
+// id, name, blob, at, any, f
+var mixedRows = testRows{
+	names: []string{"id", "name", "blob", "at", "any", "f"},
+	types: []reflect.Type{int64Type, stringType, bytesType, timeType, anyType, float64Type},
+	data: [][]driver.Value{
+		{int64(1), "a,b", []byte{0, 1, 2, 255}, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), []byte("12.5"), 1.5},
+		{nil, "", nil, []byte("2024-01-02 03:04:05+01"), nil, nil},
+		{int64(3), "q\"uote\nx", []byte{}, nil, []byte("x\x01"), 2.0},
+	},
+}
+
+func query(t *testing.T, rows testRows) *sql.Rows {
+	db := sql.OpenDB(testConnector{&testConn{rows: rows}})
+	rs, err := db.QueryContext(context.Background(), "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b buffer
+	rs := query(t, mixedRows)
+	defer rs.Close()
+	n, err := WriteCSV(&b, rs, &CSVOptions{UseLF: true})
+	if err != nil || n != 3 {
+		t.Fatalf("WriteCSV = %d, %v; want 3 rows", n, err)
+	}
+	// NULL输出为空字段, 非NULL的空字符串加上引号以示区分
+	want := "id,name,blob,at,any,f\n" +
+		"1,\"a,b\",AAEC/w==,2024-01-02T03:04:05Z,12.5,1.5\n" +
+		",\"\",,2024-01-02T03:04:05+01:00,,\n" +
+		"3,\"q\"\"uote\nx\",\"\",,x\x01,2\n"
+	if string(b.b) != want {
+		t.Errorf("WriteCSV:\n%q\nwant:\n%q", b.b, want)
+	}
+
+	b = buffer{}
+	rs2 := query(t, mixedRows)
+	defer rs2.Close()
+	if _, err := WriteCSV(&b, rs2, &CSVOptions{Comma: ';', NullText: `\N`, NoHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	want = "1;a,b;AAEC/w==;2024-01-02T03:04:05Z;12.5;1.5\r\n" +
+		"\\N;;\\N;2024-01-02T03:04:05+01:00;\\N;\\N\r\n" +
+		"3;\"q\"\"uote\nx\";;\\N;x\x01;2\r\n"
+	if string(b.b) != want {
+		t.Errorf("WriteCSV with options:\n%q\nwant:\n%q", b.b, want)
+	}
+
+	// 包含分隔符的NullText同样需要加引号
+	b = buffer{}
+	rs3 := query(t, mixedRows)
+	defer rs3.Close()
+	if _, err := WriteCSV(&b, rs3, &CSVOptions{Comma: ';', NullText: "N;A", NoHeader: true, UseLF: true}); err != nil {
+		t.Fatal(err)
+	}
+	want = "1;a,b;AAEC/w==;2024-01-02T03:04:05Z;12.5;1.5\n" +
+		"\"N;A\";;\"N;A\";2024-01-02T03:04:05+01:00;\"N;A\";\"N;A\"\n" +
+		"3;\"q\"\"uote\nx\";;\"N;A\";x\x01;2\n"
+	if string(b.b) != want {
+		t.Errorf("WriteCSV with quoted NullText:\n%q\nwant:\n%q", b.b, want)
+	}
+}
+
+func TestWriteJSONLines(t *testing.T) {
+	var b buffer
+	rs := query(t, mixedRows)
+	defer rs.Close()
+	n, err := WriteJSONLines(&b, rs)
+	if err != nil || n != 3 {
+		t.Fatalf("WriteJSONLines = %d, %v; want 3 rows", n, err)
+	}
+	// 整数和浮点数为JSON数字, 二进制列为base64, 类型未知的列为字符串
+	want := `{"id":1,"name":"a,b","blob":"AAEC/w==","at":"2024-01-02T03:04:05Z","any":"12.5","f":1.5}` + "\n" +
+		`{"id":null,"name":"","blob":null,"at":"2024-01-02T03:04:05+01:00","any":null,"f":null}` + "\n" +
+		`{"id":3,"name":"q\"uote\nx","blob":"","at":null,"any":"x\u0001","f":2}` + "\n"
+	if string(b.b) != want {
+		t.Errorf("WriteJSONLines:\n%s\nwant:\n%s", b.b, want)
+	}
+}
+
+func TestWriteColumnar(t *testing.T) {
+	var b buffer
+	rs := query(t, testRows{
+		names: []string{"id", "f", "a"},
+		types: []reflect.Type{int64Type, float64Type, anyType},
+		data: [][]driver.Value{
+			{int64(1), 1.5, int64(7)},
+			{nil, nil, nil},
+			{int64(3), 2.0, true},
+		},
+	})
+	defer rs.Close()
+	n, err := WriteColumnar(&b, rs, 2)
+	if err != nil || n != 3 {
+		t.Fatalf("WriteColumnar = %d, %v; want 3 rows", n, err)
+	}
+	want := "GDKC\x01" + "\x03" +
+		"\x02id" + "\x00" + "\x02" + // 列名, 数据库类型名, ColumnInt
+		"\x01f" + "\x00" + "\x04" + // ColumnFloat
+		"\x01a" + "\x00" + "\x01" + // 类型未知的列为ColumnString
+		// 第一个行组: 2行, 第二行为NULL
+		"\x02" +
+		"\x02" + "\x02" + "\x02" +
+		"\x09" + "\x02" + "\x00\x00\x00\x00\x00\x00\xf8\x3f" +
+		"\x03" + "\x02" + "\x017" +
+		// 第二个行组: 1行
+		"\x01" +
+		"\x02" + "\x00" + "\x06" +
+		"\x09" + "\x00" + "\x00\x00\x00\x00\x00\x00\x00\x40" +
+		"\x06" + "\x00" + "\x04true" +
+		"\x00"
+	if string(b.b) != want {
+		t.Errorf("WriteColumnar:\n%q\nwant:\n%q", b.b, want)
+	}
+}
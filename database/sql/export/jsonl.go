@@ -0,0 +1,117 @@
+package export
+
+import (
+	"github.com/dimdark/gdk/database/sql"
+	"github.com/dimdark/gdk/io"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// 将rows写为JSON Lines, 每行一个以列名为key的JSON对象;
+// 时间为RFC 3339格式的字符串, 二进制列为base64字符串, NaN和±Inf输出为null
+func WriteJSONLines(w io.Writer, rows *sql.Rows) (int64, error) {
+	s, err := newScanner(rows)
+	if err != nil {
+		return 0, err
+	}
+	keys := make([][]byte, len(s.names))
+	for i, name := range s.names {
+		keys[i] = append(appendJSONString(nil, name), ':')
+	}
+	var buf []byte
+	var n int64
+	for {
+		ok, err := s.next()
+		if !ok || err != nil {
+			return n, err
+		}
+		buf = append(buf[:0], '{')
+		for i := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, keys[i]...)
+			buf = appendJSONValue(buf, s.value(i))
+		}
+		buf = append(buf, '}', '\n')
+		if err := write(w, buf); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func appendJSONValue(dst []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, "null"...)
+	case int64:
+		return strconv.AppendInt(dst, v, 10)
+	case uint64:
+		return strconv.AppendUint(dst, v, 10)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return append(dst, "null"...)
+		}
+		return strconv.AppendFloat(dst, v, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(dst, v)
+	case string:
+		return appendJSONString(dst, v)
+	case time.Time:
+		dst = append(dst, '"')
+		dst = v.AppendFormat(dst, time.RFC3339Nano)
+		return append(dst, '"')
+	case sql.RawBytes:
+		dst = append(dst, '"')
+		dst = appendBase64(dst, v)
+		return append(dst, '"')
+	}
+	return appendJSONString(dst, string(appendText(nil, v)))
+}
+
+const hexDigits = "0123456789abcdef"
+
+// 非法的UTF-8序列替换为U+FFFD
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
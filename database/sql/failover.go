@@ -0,0 +1,178 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"sync"
+	"time"
+)
+
+// 优先使用最近一次连接成功的DSN(见Current), 失败后按优先级依次尝试其余DSN,
+// 连接失败的DSN在probeInterval之后才会被重新探测;
+// 运行Probe时失败的DSN只由后台探测恢复, Connect不再在调用中等待它们超时
+type FailoverConnector struct {
+	driver driver.Driver
+	dsns []string
+	probeInterval time.Duration
+	// 后台探测每个失败的DSN后调用, err为nil表示已恢复; 需在启动Probe之前设置
+	OnProbe func(dsn string, err error)
+
+	mu sync.Mutex
+	connectors []driver.Connector
+	failedAt []time.Time
+	current int
+	probing bool
+}
+
+var _ driver.Connector = (*FailoverConnector)(nil)
+
+func NewFailoverConnector(d driver.Driver, dsns []string, probeInterval time.Duration) (*FailoverConnector, error) {
+	if len(dsns) == 0 {
+		return nil, errors.New("sql: failover connector needs at least one DSN")
+	}
+	return &FailoverConnector{
+		driver: d,
+		dsns: dsns,
+		probeInterval: probeInterval,
+		connectors: make([]driver.Connector, len(dsns)),
+		failedAt: make([]time.Time, len(dsns)),
+	}, nil
+}
+
+func (fc *FailoverConnector) Driver() driver.Driver {
+	return fc.driver
+}
+
+// 最近一次连接成功或被探测恢复的DSN
+func (fc *FailoverConnector) Current() string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.dsns[fc.current]
+}
+
+func (fc *FailoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var lastErr error
+	for _, i := range fc.order(time.Now()) {
+		select {
+		default:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		ci, err := fc.open(ctx, i)
+		fc.mu.Lock()
+		if err == nil {
+			fc.current = i
+			fc.failedAt[i] = time.Time{}
+			fc.mu.Unlock()
+			return ci, nil
+		}
+		fc.failedAt[i] = time.Now()
+		fc.mu.Unlock()
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (fc *FailoverConnector) order(now time.Time) []int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	ready := func(i int) bool {
+		return fc.failedAt[i].IsZero() || !fc.probing && now.Sub(fc.failedAt[i]) >= fc.probeInterval
+	}
+	order := make([]int, 0, len(fc.dsns))
+	var waiting []int
+	if ready(fc.current) {
+		order = append(order, fc.current)
+	}
+	for i := range fc.dsns {
+		switch {
+		case i == fc.current && ready(i):
+		case ready(i):
+			order = append(order, i)
+		default:
+			waiting = append(waiting, i)
+		}
+	}
+	return append(order, waiting...)
+}
+
+func (fc *FailoverConnector) open(ctx context.Context, i int) (driver.Conn, error) {
+	dctx, ok := fc.driver.(driver.DriverContext)
+	if !ok {
+		return fc.driver.Open(fc.dsns[i])
+	}
+	fc.mu.Lock()
+	c := fc.connectors[i]
+	fc.mu.Unlock()
+	if c == nil {
+		var err error
+		c, err = dctx.OpenConnector(fc.dsns[i])
+		if err != nil {
+			return nil, err
+		}
+		fc.mu.Lock()
+		fc.connectors[i] = c
+		fc.mu.Unlock()
+	}
+	return c.Connect(ctx)
+}
+
+// 每隔probeInterval探测一次失败的DSN, 直到ctx结束, 一般以go fc.Probe(ctx)的方式启动;
+// 优先级高于Current的DSN恢复后, 之后的Connect重新回到该DSN; probeInterval <= 0时直接返回
+func (fc *FailoverConnector) Probe(ctx context.Context) {
+	if fc.probeInterval <= 0 {
+		return
+	}
+	fc.mu.Lock()
+	fc.probing = true
+	fc.mu.Unlock()
+	defer func() {
+		fc.mu.Lock()
+		fc.probing = false
+		fc.mu.Unlock()
+	}()
+	t := time.NewTicker(fc.probeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			fc.probe(ctx)
+		}
+	}
+}
+
+func (fc *FailoverConnector) probe(ctx context.Context) {
+	fc.mu.Lock()
+	var failed []int
+	for i, at := range fc.failedAt {
+		if !at.IsZero() {
+			failed = append(failed, i)
+		}
+	}
+	fc.mu.Unlock()
+	for _, i := range failed {
+		if ctx.Err() != nil {
+			return
+		}
+		ci, err := fc.open(ctx, i)
+		fc.mu.Lock()
+		if err != nil {
+			fc.failedAt[i] = time.Now()
+		} else {
+			fc.failedAt[i] = time.Time{}
+			if i < fc.current {
+				fc.current = i
+			}
+		}
+		fc.mu.Unlock()
+		if err == nil {
+			ci.Close()
+		}
+		if fc.OnProbe != nil {
+			fc.OnProbe(fc.dsns[i], err)
+		}
+	}
+}
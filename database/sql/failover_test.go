@@ -0,0 +1,132 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+)
+
+type flakyDriver struct {
+	mu sync.Mutex
+	down map[string]bool
+	opens map[string]int
+}
+
+func (d *flakyDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.opens[name]++
+	if d.down[name] {
+		return nil, errors.New("connection refused")
+	}
+	return &poolConn{}, nil
+}
+
+func (d *flakyDriver) setDown(name string, down bool) {
+	d.mu.Lock()
+	d.down[name] = down
+	d.mu.Unlock()
+}
+
+func (d *flakyDriver) openCount(name string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.opens[name]
+}
+
+type probeEvent struct {
+	dsn string
+	err error
+}
+
+func TestFailoverProbe(t *testing.T) {
+	ctx := context.Background()
+	d := &flakyDriver{down: map[string]bool{"a": true}, opens: map[string]int{}}
+	fc, err := NewFailoverConnector(d, []string{"a", "b"}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Current() != "b" {
+		t.Fatalf("Current = %q; want b", fc.Current())
+	}
+
+	// 每次探测后探测器停在OnProbe中, 直到测试放行
+	probes := make(chan probeEvent)
+	resume := make(chan struct{})
+	fc.OnProbe = func(dsn string, err error) {
+		probes <- probeEvent{dsn, err}
+		<-resume
+	}
+	pctx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		fc.Probe(pctx)
+		close(done)
+	}()
+	if ev := <-probes; ev.dsn != "a" || ev.err == nil {
+		t.Fatalf("probe = %+v; want a failed probe of a", ev)
+	}
+	// 探测期间Connect不再尝试已失败的a
+	n := d.openCount("a")
+	if _, err := fc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d.openCount("a") != n {
+		t.Error("Connect tried the failed DSN while probing")
+	}
+
+	d.setDown("a", false)
+	resume <- struct{}{}
+	for ev := range probes {
+		if ev.err == nil {
+			break
+		}
+		resume <- struct{}{}
+	}
+	if fc.Current() != "a" {
+		t.Errorf("Current after recovery = %q; want a", fc.Current())
+	}
+	stop()
+	resume <- struct{}{}
+	<-done
+	if _, err := fc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d.openCount("b") != 2 {
+		t.Errorf("b opened %d times; want Connect back on a", d.openCount("b"))
+	}
+}
+
+func TestFailoverPrefersCurrent(t *testing.T) {
+	ctx := context.Background()
+	d := &flakyDriver{down: map[string]bool{"a": true}, opens: map[string]int{}}
+	fc, err := NewFailoverConnector(d, []string{"a", "b"}, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// a已到重试时间, 但Connect仍优先使用刚刚成功的b
+	d.setDown("a", false)
+	n := d.openCount("a")
+	if _, err := fc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d.openCount("a") != n || fc.Current() != "b" {
+		t.Errorf("Current = %q after %d new opens of a; want to stay on b", fc.Current(), d.openCount("a")-n)
+	}
+	d.setDown("b", true)
+	if _, err := fc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Current() != "a" {
+		t.Errorf("Current = %q; want a after b failed", fc.Current())
+	}
+}
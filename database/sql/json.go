@@ -0,0 +1,70 @@
+package sql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/dimdark/gdk/database/sql/driver"
+)
+
+// JSON列的读写, V为写入时被编码的值, 读取时必须是指向目标的指针
+// Strict为true时读取遇到V中不存在的字段会返回错误
+type JSON struct {
+	V interface{}
+	Strict bool
+}
+
+func (j JSON) Value() (driver.Value, error) {
+	return json.Marshal(j.V)
+}
+
+func (j *JSON) Scan(src interface{}) error {
+	var data []byte
+	switch s := src.(type) {
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	case nil:
+		return fmt.Errorf("sql: converting NULL to JSON is unsupported, use NullJSON")
+	default:
+		return fmt.Errorf("sql: cannot scan %T into JSON", src)
+	}
+	r := bytes.NewReader(data)
+	dec := json.NewDecoder(r)
+	if j.Strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(j.V); err != nil {
+		return err
+	}
+	// 与json.Unmarshal一致, 第一个JSON值之后只允许空白
+	var rest bytes.Buffer
+	rest.ReadFrom(dec.Buffered())
+	rest.ReadFrom(r)
+	if len(bytes.TrimSpace(rest.Bytes())) > 0 {
+		return fmt.Errorf("sql: trailing data after JSON value")
+	}
+	return nil
+}
+
+type NullJSON struct {
+	JSON
+	Valid bool
+}
+
+func (n NullJSON) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.JSON.Value()
+}
+
+func (n *NullJSON) Scan(src interface{}) error {
+	if src == nil {
+		n.Valid = false
+		return nil
+	}
+	n.Valid = true
+	return n.JSON.Scan(src)
+}
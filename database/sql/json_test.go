@@ -0,0 +1,60 @@
+package sql
+
+import "testing"
+
+func TestJSONScanTrailingData(t *testing.T) {
+	tests := []struct {
+		src string
+		ok bool
+	}{
+		{`{"a":1}`, true},
+		{"{\"a\":1}\n\t ", true},
+		{`{"a":1}{"a":2}`, false},
+		{`{"a":1} x`, false},
+		{`[1] [2]`, false},
+	}
+	for _, strict := range []bool{false, true} {
+		for _, tt := range tests {
+			var v interface{}
+			j := JSON{V: &v, Strict: strict}
+			err := j.Scan([]byte(tt.src))
+			if (err == nil) != tt.ok {
+				t.Errorf("Scan(%q) strict=%v err = %v; want ok=%v", tt.src, strict, err, tt.ok)
+			}
+		}
+	}
+}
+
+type jsonUser struct {
+	Name string `json:"name"`
+	Age int `json:"age"`
+}
+
+func TestJSONStrict(t *testing.T) {
+	src := []byte(`{"name":"gopher","age":10,"email":"g@example.com"}`)
+	var u jsonUser
+	if err := (&JSON{V: &u}).Scan(src); err != nil || u != (jsonUser{"gopher", 10}) {
+		t.Errorf("lenient Scan = %+v, %v; want the known fields", u, err)
+	}
+	u = jsonUser{}
+	if err := (&JSON{V: &u, Strict: true}).Scan(src); err == nil {
+		t.Errorf("strict Scan with an unknown field succeeded: %+v", u)
+	}
+	if err := (&JSON{V: &u, Strict: true}).Scan(`{"name":"gopher"}`); err != nil || u.Name != "gopher" {
+		t.Errorf("strict Scan of known fields = %+v, %v", u, err)
+	}
+}
+
+func TestNullJSONStrict(t *testing.T) {
+	var u jsonUser
+	n := NullJSON{JSON: JSON{V: &u, Strict: true}}
+	if err := n.Scan([]byte(`{"name":"gopher","email":"g@example.com"}`)); err == nil {
+		t.Errorf("strict Scan with an unknown field succeeded: %+v", u)
+	}
+	if err := n.Scan([]byte(`{"name":"gopher","age":10}`)); err != nil || !n.Valid || u != (jsonUser{"gopher", 10}) {
+		t.Errorf("strict Scan = %+v, valid=%v, %v", u, n.Valid, err)
+	}
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Errorf("Scan(nil) valid=%v, %v; want invalid", n.Valid, err)
+	}
+}
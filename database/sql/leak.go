@@ -0,0 +1,165 @@
+package sql
+
+import (
+	"log"
+	"runtime"
+	"sync"
+	"time"
+)
+
+type LeakReport struct {
+	Kind string
+	Acquired time.Time
+	Held time.Duration
+	Stack []byte
+	// 为true表示持有者已被GC回收但连接从未归还
+	Collected bool
+}
+
+type leakDetector struct {
+	threshold time.Duration
+	report func(LeakReport)
+
+	mu sync.Mutex
+	traces map[*leakTrace]struct{}
+	stop chan struct{}
+	// watch退出后关闭
+	done chan struct{}
+}
+
+type leakTrace struct {
+	kind string
+	acquired time.Time
+	stack []byte
+	reported bool
+	released bool
+}
+
+// 开启连接泄露检测, threshold <= 0 时关闭; DB关闭后不再开启
+func (db *DB) SetLeakDetection(threshold time.Duration, report func(LeakReport)) {
+	if report == nil {
+		report = logLeak
+	}
+	var ld *leakDetector
+	if threshold > 0 {
+		ld = &leakDetector{
+			threshold: threshold,
+			report: report,
+			traces: make(map[*leakTrace]struct{}),
+			stop: make(chan struct{}),
+			done: make(chan struct{}),
+		}
+	}
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return
+	}
+	old := db.leaks
+	db.leaks = ld
+	db.mu.Unlock()
+	if ld != nil {
+		go ld.watch()
+	}
+	old.close()
+}
+
+// 停止后台检查, 已经取出的连接归还时仍可调用release
+func (ld *leakDetector) close() {
+	if ld != nil {
+		close(ld.stop)
+	}
+}
+
+func logLeak(r LeakReport) {
+	if r.Collected {
+		log.Printf("sql: %s garbage collected without being released, acquired at:\n%s", r.Kind, r.Stack)
+		return
+	}
+	log.Printf("sql: %s held for %v, acquired at:\n%s", r.Kind, r.Held, r.Stack)
+}
+
+func (db *DB) leakDetector() *leakDetector {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.leaks
+}
+
+func (ld *leakDetector) track(kind string) *leakTrace {
+	if ld == nil {
+		return nil
+	}
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	t := &leakTrace{kind: kind, acquired: time.Now(), stack: buf}
+	ld.mu.Lock()
+	ld.traces[t] = struct{}{}
+	ld.mu.Unlock()
+	return t
+}
+
+func (ld *leakDetector) release(t *leakTrace) {
+	if ld == nil || t == nil {
+		return
+	}
+	ld.mu.Lock()
+	t.released = true
+	delete(ld.traces, t)
+	ld.mu.Unlock()
+}
+
+func (ld *leakDetector) collected(t *leakTrace) {
+	ld.mu.Lock()
+	if t.released {
+		ld.mu.Unlock()
+		return
+	}
+	delete(ld.traces, t)
+	ld.mu.Unlock()
+	ld.report(LeakReport{
+		Kind: t.kind,
+		Acquired: t.acquired,
+		Held: time.Since(t.acquired),
+		Stack: t.stack,
+		Collected: true,
+	})
+}
+
+func (ld *leakDetector) watch() {
+	interval := ld.threshold / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	defer close(ld.done)
+	for {
+		select {
+		case <-ld.stop:
+			return
+		case now := <-tk.C:
+			ld.check(now)
+		}
+	}
+}
+
+func (ld *leakDetector) check(now time.Time) {
+	var reports []LeakReport
+	ld.mu.Lock()
+	for t := range ld.traces {
+		if t.reported || now.Sub(t.acquired) < ld.threshold {
+			continue
+		}
+		t.reported = true
+		reports = append(reports, LeakReport{
+			Kind: t.kind,
+			Acquired: t.acquired,
+			Held: now.Sub(t.acquired),
+			Stack: t.stack,
+		})
+	}
+	ld.mu.Unlock()
+	for _, r := range reports {
+		ld.report(r)
+	}
+}
@@ -0,0 +1,75 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeakReport(t *testing.T) {
+	db := OpenDB(&apiConnector{})
+	defer db.Close()
+	reports := make(chan LeakReport, 4)
+	db.SetLeakDetection(10*time.Millisecond, func(r LeakReport) { reports <- r })
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	rows, err := db.QueryContext(context.Background(), "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	got := make(map[string]LeakReport)
+	for len(got) < 2 {
+		select {
+		case r := <-reports:
+			got[r.Kind] = r
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got reports for %v; want Tx and Rows", got)
+		}
+	}
+	for _, kind := range []string{"Tx", "Rows"} {
+		r, ok := got[kind]
+		if !ok {
+			t.Errorf("no report for %s", kind)
+			continue
+		}
+		if r.Collected || r.Held < 10*time.Millisecond {
+			t.Errorf("%s report = %+v; want held past the threshold", kind, r)
+		}
+		// 调用栈指向取得资源的位置
+		if !bytes.Contains(r.Stack, []byte("TestLeakReport")) {
+			t.Errorf("%s report stack does not include the caller:\n%s", kind, r.Stack)
+		}
+	}
+	// 每个资源只报告一次
+	select {
+	case r := <-reports:
+		t.Errorf("duplicate report %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCloseStopsLeakWatcher(t *testing.T) {
+	db := OpenDB(&apiConnector{})
+	db.SetLeakDetection(time.Millisecond, nil)
+	ld := db.leakDetector()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ld.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leak watcher still running after Close")
+	}
+	// 关闭后不再开启新的检查
+	db.SetLeakDetection(time.Millisecond, nil)
+	if db.leakDetector() != nil {
+		t.Error("SetLeakDetection started a watcher on a closed DB")
+	}
+}
@@ -0,0 +1,370 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dimdark/gdk/database/sql"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoChange = errors.New("migrate: no change")
+
+type DirtyError struct {
+	Version int64
+}
+func (e *DirtyError) Error() string {
+	return "migrate: database is dirty at version " + strconv.FormatInt(e.Version, 10) + ", fix it and force the version"
+}
+
+type Migration struct {
+	Version int64
+	Name string
+	Up string
+	Down string
+}
+
+// 迁移文件的来源, 文件名格式为 <version>_<name>.up.sql 和 <version>_<name>.down.sql
+type Source interface {
+	ReadDir() ([]string, error)
+	ReadFile(name string) ([]byte, error)
+}
+
+type dirSource string
+
+func Dir(path string) Source {
+	return dirSource(path)
+}
+
+func (d dirSource) ReadDir() ([]string, error) {
+	infos, err := ioutil.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range infos {
+		if !fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d dirSource) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(d), name))
+}
+
+func Load(src Source) ([]Migration, error) {
+	names, err := src.ReadDir()
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, name := range names {
+		var up bool
+		var base string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			up, base = true, strings.TrimSuffix(name, ".up.sql")
+		case strings.HasSuffix(name, ".down.sql"):
+			base = strings.TrimSuffix(name, ".down.sql")
+		default:
+			continue
+		}
+		vs, title := base, ""
+		if i := strings.IndexByte(base, '_'); i >= 0 {
+			vs, title = base[:i], base[i+1:]
+		}
+		version, err := strconv.ParseInt(vs, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrate: invalid migration file name %q", name)
+		}
+		body, err := src.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		} else if m.Name != title {
+			return nil, fmt.Errorf("migrate: version %d used by both %q and %q", version, m.Name, title)
+		}
+		if up {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// 防止多个迁移进程同时执行
+type Locker interface {
+	Lock(ctx context.Context, c *sql.Conn) error
+	Unlock(ctx context.Context, c *sql.Conn) error
+}
+
+// 通过向锁表插入固定主键实现的锁, 适用于不支持advisory lock的数据库.
+// 锁记录带有加锁时间, StaleAfter > 0 时超过该时长的锁视为持有者已崩溃而被清除;
+// 也可以通过Migrator.ForceUnlock手工释放
+type TableLocker struct {
+	Table string
+	RetryInterval time.Duration
+	StaleAfter time.Duration
+}
+
+func (l *TableLocker) Lock(ctx context.Context, c *sql.Conn) error {
+	if _, err := c.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+l.Table+" (id INTEGER PRIMARY KEY, locked_at BIGINT NOT NULL)"); err != nil {
+		return err
+	}
+	interval := l.RetryInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		_, err := c.ExecContext(ctx, "INSERT INTO "+l.Table+" (id, locked_at) VALUES (1, "+
+			strconv.FormatInt(time.Now().Unix(), 10)+")")
+		if err == nil {
+			return nil
+		}
+		// 只有主键冲突说明锁被其他进程持有, 其他错误(如连接断开)直接返回
+		if !sql.IsIntegrityViolation(err) {
+			return err
+		}
+		if l.StaleAfter > 0 {
+			stale := time.Now().Add(-l.StaleAfter).Unix()
+			if _, err := c.ExecContext(ctx, "DELETE FROM "+l.Table+" WHERE id = 1 AND locked_at < "+
+				strconv.FormatInt(stale, 10)); err != nil {
+				return err
+			}
+		}
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (l *TableLocker) Unlock(ctx context.Context, c *sql.Conn) error {
+	_, err := c.ExecContext(ctx, "DELETE FROM "+l.Table+" WHERE id = 1")
+	return err
+}
+
+type Migrator struct {
+	db *sql.DB
+	src Source
+	Table string
+	Locker Locker
+}
+
+func New(db *sql.DB, src Source) *Migrator {
+	return &Migrator{
+		db: db,
+		src: src,
+		Table: "schema_migrations",
+		Locker: &TableLocker{Table: "schema_migrations_lock"},
+	}
+}
+
+const unlockTimeout = 10 * time.Second
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (driver.Result, error)
+}
+
+func (m *Migrator) run(ctx context.Context, fn func(c *sql.Conn, migrations []Migration) error) (err error) {
+	migrations, err := Load(m.src)
+	if err != nil {
+		return err
+	}
+	c, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if m.Locker != nil {
+		if err := m.Locker.Lock(ctx, c); err != nil {
+			return err
+		}
+		defer func() {
+			// ctx可能已经被取消, 释放锁使用单独的ctx, 否则锁会一直残留
+			uctx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+			defer cancel()
+			if uerr := m.Locker.Unlock(uctx, c); err == nil {
+				err = uerr
+			}
+		}()
+	}
+	if _, err := c.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.Table+" (version BIGINT NOT NULL, dirty BOOLEAN NOT NULL)"); err != nil {
+		return err
+	}
+	return fn(c, migrations)
+}
+
+func (m *Migrator) version(ctx context.Context, c *sql.Conn) (version int64, dirty bool, err error) {
+	rows, err := c.QueryContext(ctx, "SELECT version, dirty FROM "+m.Table)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(&version, &dirty); err != nil {
+			return 0, false, err
+		}
+	}
+	return version, dirty, rows.Err()
+}
+
+func (m *Migrator) setVersion(ctx context.Context, ex execer, version int64, dirty bool) error {
+	if _, err := ex.ExecContext(ctx, "DELETE FROM "+m.Table); err != nil {
+		return err
+	}
+	if version == 0 && !dirty {
+		return nil
+	}
+	_, err := ex.ExecContext(ctx, "INSERT INTO "+m.Table+" (version, dirty) VALUES ("+
+		strconv.FormatInt(version, 10)+", "+strings.ToUpper(strconv.FormatBool(dirty))+")")
+	return err
+}
+
+// 执行版本为version的迁移并把版本号更新为target, 支持事务性DDL时整个过程在一个事务中完成,
+// 否则先将version标记为dirty, 成功后再清除, 失败时DirtyError.Version即为失败的迁移
+func (m *Migrator) apply(ctx context.Context, c *sql.Conn, version, target int64, query string) error {
+	if c.SupportsTransactionalDDL() {
+		tx, err := c.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := m.setVersion(ctx, tx, target, false); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+	if err := m.setVersion(ctx, c, version, true); err != nil {
+		return err
+	}
+	if _, err := c.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	return m.setVersion(ctx, c, target, false)
+}
+
+func (m *Migrator) Version(ctx context.Context) (version int64, dirty bool, err error) {
+	err = m.run(ctx, func(c *sql.Conn, _ []Migration) error {
+		version, dirty, err = m.version(ctx, c)
+		return err
+	})
+	return version, dirty, err
+}
+
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Steps(ctx, -1, true)
+}
+
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.Steps(ctx, -1, false)
+}
+
+type step struct {
+	version int64
+	target int64
+	query string
+}
+
+// 执行n个迁移, n < 0 表示执行全部.
+// 要执行的迁移中有缺少对应方向脚本(文件不存在或内容为空)的, 不执行任何迁移直接返回错误
+func (m *Migrator) Steps(ctx context.Context, n int, up bool) error {
+	return m.run(ctx, func(c *sql.Conn, migrations []Migration) error {
+		current, dirty, err := m.version(ctx, c)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return &DirtyError{Version: current}
+		}
+		var steps []step
+		if up {
+			for _, mg := range migrations {
+				if mg.Version <= current {
+					continue
+				}
+				if n >= 0 && len(steps) == n {
+					break
+				}
+				if strings.TrimSpace(mg.Up) == "" {
+					return fmt.Errorf("migrate: migration %d has no up script", mg.Version)
+				}
+				steps = append(steps, step{mg.Version, mg.Version, mg.Up})
+			}
+		} else {
+			for i := len(migrations) - 1; i >= 0; i-- {
+				mg := migrations[i]
+				if mg.Version > current {
+					continue
+				}
+				if n >= 0 && len(steps) == n {
+					break
+				}
+				if strings.TrimSpace(mg.Down) == "" {
+					return fmt.Errorf("migrate: migration %d has no down script", mg.Version)
+				}
+				var prev int64
+				if i > 0 {
+					prev = migrations[i-1].Version
+				}
+				steps = append(steps, step{mg.Version, prev, mg.Down})
+			}
+		}
+		if len(steps) == 0 {
+			return ErrNoChange
+		}
+		for _, st := range steps {
+			if err := m.apply(ctx, c, st.version, st.target, st.query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 强制设置版本号并清除dirty标记, 用于手工修复失败的迁移之后
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	return m.run(ctx, func(c *sql.Conn, _ []Migration) error {
+		return m.setVersion(ctx, c, version, false)
+	})
+}
+
+// 释放残留的迁移锁, 用于迁移进程崩溃之后, 调用方需确认没有其他迁移正在执行
+func (m *Migrator) ForceUnlock(ctx context.Context) error {
+	if m.Locker == nil {
+		return nil
+	}
+	c, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return m.Locker.Unlock(ctx, c)
+}
@@ -0,0 +1,309 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dimdark/gdk/database/sql"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mapSource map[string]string
+
+func (s mapSource) ReadDir() ([]string, error) {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (s mapSource) ReadFile(name string) ([]byte, error) {
+	body, ok := s[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(body), nil
+}
+
+var testSource = mapSource{
+	"1_users.up.sql":   "create users",
+	"1_users.down.sql": "drop users",
+	"2_posts.up.sql":   "create posts",
+	"2_posts.down.sql": "drop posts",
+	"3_tags.up.sql":    "create tags",
+	"3_tags.down.sql":  "drop tags",
+}
+
+type uniqueViolation struct{}
+
+func (uniqueViolation) Error() string      { return "duplicate key" }
+func (uniqueViolation) SQLState() string   { return "23505" }
+func (uniqueViolation) Severity() string   { return "ERROR" }
+func (uniqueViolation) Constraint() string { return "" }
+func (uniqueViolation) Table() string      { return "" }
+func (uniqueViolation) Column() string     { return "" }
+
+// 所有连接共享的数据库状态, 只理解迁移器会执行的语句
+type fakeDB struct {
+	mu            sync.Mutex
+	transactional bool
+	locked        bool
+	lockedAt      int64
+	lockErr       error
+	hasVersion    bool
+	version       int64
+	dirty         bool
+	failOn        string
+	applied       []string
+}
+
+func (db *fakeDB) exec(query string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var a, b int64
+	var dirty string
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE"):
+	case strings.HasPrefix(query, "INSERT INTO lock "):
+		if db.lockErr != nil {
+			return db.lockErr
+		}
+		if db.locked {
+			return uniqueViolation{}
+		}
+		fmt.Sscanf(query, "INSERT INTO lock (id, locked_at) VALUES (1, %d)", &db.lockedAt)
+		db.locked = true
+	case query == "DELETE FROM lock WHERE id = 1":
+		db.locked = false
+	case strings.HasPrefix(query, "DELETE FROM lock WHERE id = 1 AND locked_at < "):
+		fmt.Sscanf(query, "DELETE FROM lock WHERE id = 1 AND locked_at < %d", &a)
+		if db.lockedAt < a {
+			db.locked = false
+		}
+	case query == "DELETE FROM versions":
+		db.hasVersion = false
+	case strings.HasPrefix(query, "INSERT INTO versions "):
+		fmt.Sscanf(query, "INSERT INTO versions (version, dirty) VALUES (%d, %s", &b, &dirty)
+		db.hasVersion, db.version, db.dirty = true, b, dirty == "TRUE)"
+	default:
+		if query == db.failOn {
+			return errors.New("migration failed")
+		}
+		db.applied = append(db.applied, query)
+	}
+	return nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *fakeConn) Close() error                   { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)      { return c, nil }
+func (c *fakeConn) Commit() error                  { return nil }
+func (c *fakeConn) Rollback() error                { return nil }
+func (c *fakeConn) SupportsTransactionalDDL() bool { return c.db.transactional }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.db.exec(query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	rows := &versionRows{}
+	if c.db.hasVersion {
+		rows.rows = [][]driver.Value{{c.db.version, c.db.dirty}}
+	}
+	return rows, nil
+}
+
+type versionRows struct {
+	rows [][]driver.Value
+}
+
+func (r *versionRows) Columns() []string { return []string{"version", "dirty"} }
+func (r *versionRows) Close() error      { return nil }
+func (r *versionRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+type fakeConnector struct {
+	db *fakeDB
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{c.db}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+func newTestMigrator(db *fakeDB) *Migrator {
+	m := New(sql.OpenDB(fakeConnector{db}), testSource)
+	m.Table = "versions"
+	m.Locker = &TableLocker{Table: "lock", RetryInterval: time.Millisecond}
+	return m
+}
+
+func checkVersion(t *testing.T, m *Migrator, version int64, dirty bool) {
+	t.Helper()
+	v, d, err := m.Version(context.Background())
+	if err != nil || v != version || d != dirty {
+		t.Fatalf("Version() = %d, %v, %v; want %d, %v", v, d, err, version, dirty)
+	}
+}
+
+func TestUpDownSteps(t *testing.T) {
+	for _, transactional := range []bool{false, true} {
+		db := &fakeDB{transactional: transactional}
+		m := newTestMigrator(db)
+		ctx := context.Background()
+		if err := m.Steps(ctx, 2, true); err != nil {
+			t.Fatal(err)
+		}
+		checkVersion(t, m, 2, false)
+		if err := m.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		checkVersion(t, m, 3, false)
+		if err := m.Up(ctx); err != ErrNoChange {
+			t.Errorf("Up at latest version = %v; want ErrNoChange", err)
+		}
+		if err := m.Steps(ctx, 1, false); err != nil {
+			t.Fatal(err)
+		}
+		checkVersion(t, m, 2, false)
+		if err := m.Down(ctx); err != nil {
+			t.Fatal(err)
+		}
+		checkVersion(t, m, 0, false)
+		want := []string{"create users", "create posts", "create tags", "drop tags", "drop posts", "drop users"}
+		if !reflect.DeepEqual(db.applied, want) {
+			t.Errorf("applied = %q; want %q", db.applied, want)
+		}
+		if db.locked {
+			t.Error("lock still held after migrations")
+		}
+	}
+}
+
+func TestDirty(t *testing.T) {
+	db := &fakeDB{failOn: "create posts"}
+	m := newTestMigrator(db)
+	ctx := context.Background()
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("Up succeeded with a failing migration")
+	}
+	checkVersion(t, m, 2, true)
+	if err := m.Up(ctx); !reflect.DeepEqual(err, &DirtyError{Version: 2}) {
+		t.Fatalf("Up on dirty database = %v; want DirtyError at version 2", err)
+	}
+	db.failOn = ""
+	if err := m.Force(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion(t, m, 3, false)
+}
+
+func TestDirtyDown(t *testing.T) {
+	db := &fakeDB{failOn: "drop users"}
+	m := newTestMigrator(db)
+	ctx := context.Background()
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(ctx); err == nil {
+		t.Fatal("Down succeeded with a failing migration")
+	}
+	// 失败的是版本1的down脚本, 而不是回退的目标版本0
+	checkVersion(t, m, 1, true)
+	if err := m.Down(ctx); !reflect.DeepEqual(err, &DirtyError{Version: 1}) {
+		t.Fatalf("Down on dirty database = %v; want DirtyError at version 1", err)
+	}
+}
+
+func TestMissingScript(t *testing.T) {
+	src := mapSource{
+		"1_users.up.sql":   "create users",
+		"2_posts.up.sql":   "create posts",
+		"2_posts.down.sql": "drop posts",
+		"3_tags.down.sql":  "drop tags",
+	}
+	db := &fakeDB{}
+	m := newTestMigrator(db)
+	m.src = src
+	ctx := context.Background()
+	if err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "migration 3 has no up script") {
+		t.Fatalf("Up with a missing up script = %v", err)
+	}
+	if len(db.applied) != 0 {
+		t.Fatalf("migrations applied before the missing script was found: %q", db.applied)
+	}
+	if err := m.Steps(ctx, 2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(ctx); err == nil || !strings.Contains(err.Error(), "migration 1 has no down script") {
+		t.Fatalf("Down with a missing down script = %v", err)
+	}
+	if err := m.Steps(ctx, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion(t, m, 1, false)
+}
+
+func TestLockContention(t *testing.T) {
+	db := &fakeDB{locked: true, lockedAt: time.Now().Unix()}
+	m := newTestMigrator(db)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Up(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Up with lock held = %v; want context.DeadlineExceeded", err)
+	}
+	if len(db.applied) != 0 {
+		t.Fatalf("migrations applied while locked: %q", db.applied)
+	}
+
+	// 崩溃的进程留下的锁
+	db.lockedAt = time.Now().Add(-time.Hour).Unix()
+	m.Locker.(*TableLocker).StaleAfter = time.Minute
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if db.locked {
+		t.Error("lock still held after migrations")
+	}
+
+	db.locked = true
+	if err := m.ForceUnlock(context.Background()); err != nil || db.locked {
+		t.Errorf("ForceUnlock = %v, locked = %v", err, db.locked)
+	}
+}
+
+func TestLockError(t *testing.T) {
+	db := &fakeDB{lockErr: driver.ErrBadConn}
+	m := newTestMigrator(db)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Up(ctx); err != driver.ErrBadConn {
+		t.Fatalf("Up with broken connection = %v; want driver.ErrBadConn", err)
+	}
+}
@@ -0,0 +1,212 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"testing"
+)
+
+type poolConn struct {
+	driver.Conn
+	id int
+	err error
+	resetErr error
+	closed bool
+}
+
+func (c *poolConn) Close() error {
+	c.closed = true
+	return nil
+}
+func (c *poolConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return driver.RowsAffected(1), nil
+}
+func (c *poolConn) Begin() (driver.Tx, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return nil, errors.New("transactions are not supported")
+}
+func (c *poolConn) Ping(ctx context.Context) error {
+	return c.err
+}
+func (c *poolConn) ResetSession(ctx context.Context) error {
+	return c.resetErr
+}
+
+type poolConnector struct {
+	conns []*poolConn
+}
+
+func (p *poolConnector) Connect(context.Context) (driver.Conn, error) {
+	c := &poolConn{id: len(p.conns)}
+	p.conns = append(p.conns, c)
+	return c, nil
+}
+func (p *poolConnector) Driver() driver.Driver { return nil }
+
+func TestPoolReuse(t *testing.T) {
+	ctx := context.Background()
+	p := &poolConnector{}
+	db := OpenDB(p)
+	for i := 0; i < 3; i++ {
+		ci, err := db.connect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.putConn(ci, nil)
+	}
+	if len(p.conns) != 1 {
+		t.Fatalf("opened %d conns; want the idle conn reused", len(p.conns))
+	}
+
+	// 重置会话失败的空闲连接被关闭, 换新连接
+	p.conns[0].resetErr = errors.New("reset failed")
+	ci, err := db.connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.conns[0].closed || ci != p.conns[1] {
+		t.Fatalf("conn with failed reset was reused")
+	}
+
+	// 坏连接不再放回空闲列表
+	db.putConn(ci, driver.ErrBadConn)
+	if !p.conns[1].closed {
+		t.Error("bad conn was not closed")
+	}
+
+	// 超出空闲上限的连接在归还时关闭
+	db.SetMaxIdleConns(1)
+	c1, _ := db.connect(ctx)
+	c2, _ := db.connect(ctx)
+	db.putConn(c1, nil)
+	db.putConn(c2, nil)
+	if p.conns[2].closed || !p.conns[3].closed {
+		t.Errorf("closed = %v, %v; want only the conn over the idle limit closed", p.conns[2].closed, p.conns[3].closed)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.conns[2].closed {
+		t.Error("Close left an idle conn open")
+	}
+	if _, err := db.connect(ctx); err != errDBClosed {
+		t.Errorf("connect after Close err = %v; want errDBClosed", err)
+	}
+}
+
+func TestMaxIdleConns(t *testing.T) {
+	ctx := context.Background()
+	p := &poolConnector{}
+	db := OpenDB(p)
+	db.SetMaxIdleConns(0)
+	for i := 0; i < 2; i++ {
+		ci, err := db.connect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.putConn(ci, nil)
+	}
+	if len(p.conns) != 2 || !p.conns[0].closed || !p.conns[1].closed {
+		t.Errorf("with no idle conns allowed every conn must be closed after use")
+	}
+}
+
+func TestConnHooks(t *testing.T) {
+	ctx := context.Background()
+	p := &poolConnector{}
+	db := OpenDB(p)
+	var connects, checkouts, checkins, closes int
+	reject := -1
+	db.SetConnHooks(ConnHooks{
+		OnConnect: func(context.Context, driver.Conn) error {
+			connects++
+			return nil
+		},
+		OnCheckout: func(_ context.Context, ci driver.Conn) error {
+			checkouts++
+			if ci.(*poolConn).id == reject {
+				return errors.New("rejected")
+			}
+			return nil
+		},
+		OnCheckin: func(driver.Conn, error) { checkins++ },
+		OnClose: func(driver.Conn, error) { closes++ },
+	})
+	for i := 0; i < 3; i++ {
+		ci, err := db.connect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.putConn(ci, nil)
+	}
+	if len(p.conns) != 1 || connects != 1 || checkouts != 3 || checkins != 3 {
+		t.Fatalf("conns=%d connects=%d checkouts=%d checkins=%d; want 1, 1, 3, 3",
+			len(p.conns), connects, checkouts, checkins)
+	}
+
+	// 被OnCheckout拒绝的空闲连接被关闭, 换新连接重试
+	reject = 0
+	ci, err := db.connect(ctx)
+	if err != nil {
+		t.Fatalf("connect after rejected checkout: %v", err)
+	}
+	if !p.conns[0].closed || ci != p.conns[1] || closes != 1 {
+		t.Fatalf("rejected conn closed=%v, closes=%d; want it closed and a new conn", p.conns[0].closed, closes)
+	}
+
+	// 新建的连接被拒绝时直接返回错误
+	db.putConn(ci, driver.ErrBadConn)
+	reject = 2
+	if _, err := db.connect(ctx); err == nil {
+		t.Error("connect succeeded although OnCheckout rejected the new conn")
+	}
+	if len(p.conns) != 3 || !p.conns[2].closed {
+		t.Errorf("conns=%d; want the rejected new conn closed without retrying", len(p.conns))
+	}
+}
+
+// 经由Conn、PingContext和ExecBatch遇到ErrBadConn的连接同样不能放回空闲列表
+func TestBadConnNotReused(t *testing.T) {
+	ctx := context.Background()
+	p := &poolConnector{}
+	db := OpenDB(p)
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.conns[0].err = driver.ErrBadConn
+	if _, err := c.ExecContext(ctx, "q"); err != driver.ErrBadConn {
+		t.Fatalf("Conn.ExecContext err = %v; want ErrBadConn", err)
+	}
+	if !p.conns[0].closed {
+		t.Error("Conn did not close its bad conn")
+	}
+
+	ci, _ := db.connect(ctx)
+	ci.(*poolConn).err = driver.ErrBadConn
+	db.putConn(ci, nil)
+	if err := db.PingContext(ctx); err != driver.ErrBadConn {
+		t.Fatalf("PingContext err = %v; want ErrBadConn", err)
+	}
+	if !p.conns[1].closed {
+		t.Error("PingContext returned a bad conn to the pool")
+	}
+
+	ci, _ = db.connect(ctx)
+	ci.(*poolConn).err = driver.ErrBadConn
+	db.putConn(ci, nil)
+	if _, err := db.ExecBatch(ctx, "q", [][]interface{}{{1}}); !isBadConn(err) {
+		t.Fatalf("ExecBatch err = %v; want ErrBadConn", err)
+	}
+	if !p.conns[2].closed {
+		t.Error("ExecBatch returned a bad conn to the pool")
+	}
+}
@@ -0,0 +1,203 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"testing"
+)
+
+// 实现ExecerContext和QueryerContext的连接, "bad"返回ErrBadConn, "fail"返回普通错误
+type apiConn struct {
+	driver.Conn
+	execs []string
+	closed bool
+	txs int
+}
+
+func apiErr(query string) error {
+	switch query {
+	case "bad":
+		return driver.ErrBadConn
+	case "fail":
+		return errors.New("fail")
+	}
+	return nil
+}
+
+func (c *apiConn) Close() error {
+	c.closed = true
+	return nil
+}
+func (c *apiConn) Begin() (driver.Tx, error) {
+	c.txs++
+	return apiTx{}, nil
+}
+func (c *apiConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := apiErr(query); err != nil {
+		return nil, err
+	}
+	c.execs = append(c.execs, query)
+	return driver.RowsAffected(len(args)), nil
+}
+func (c *apiConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := apiErr(query); err != nil {
+		return nil, err
+	}
+	return &apiRows{data: [][]driver.Value{{int64(1), "a"}, {int64(2), []byte("b")}}}, nil
+}
+
+type apiTx struct{}
+
+func (apiTx) Commit() error   { return nil }
+func (apiTx) Rollback() error { return nil }
+
+type apiRows struct {
+	data [][]driver.Value
+}
+
+func (r *apiRows) Columns() []string { return []string{"id", "name"} }
+func (r *apiRows) Close() error      { return nil }
+func (r *apiRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
+
+type apiConnector struct {
+	conns []*apiConn
+}
+
+func (p *apiConnector) Connect(context.Context) (driver.Conn, error) {
+	c := &apiConn{}
+	p.conns = append(p.conns, c)
+	return c, nil
+}
+func (p *apiConnector) Driver() driver.Driver { return nil }
+
+func scanAll(t *testing.T, rows *Rows) []string {
+	var got []string
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestDBQuery(t *testing.T) {
+	ctx := context.Background()
+	p := &apiConnector{}
+	db := OpenDB(p)
+	for i := 0; i < 2; i++ {
+		rows, err := db.QueryContext(ctx, "q")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cols, err := rows.Columns(); err != nil || len(cols) != 2 || cols[1] != "name" {
+			t.Errorf("Columns = %v, %v", cols, err)
+		}
+		if got := scanAll(t, rows); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+			t.Errorf("rows = %q; want [a b]", got)
+		}
+		// Next返回false后Rows已关闭
+		if err := rows.Scan(new(int64), new(string)); err == nil {
+			t.Error("Scan after the last row succeeded")
+		}
+	}
+	if len(p.conns) != 1 {
+		t.Errorf("opened %d conns; want the conn released by Rows reused", len(p.conns))
+	}
+	if _, err := db.QueryContext(ctx, "fail"); err == nil || err.Error() != "fail" {
+		t.Errorf("QueryContext err = %v; want fail", err)
+	}
+
+	res, err := db.ExecContext(ctx, "e", 1, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("RowsAffected = %d; want 2", n)
+	}
+	if _, err := db.ExecContext(ctx, "bad"); err != driver.ErrBadConn {
+		t.Fatalf("ExecContext err = %v; want ErrBadConn", err)
+	}
+	if !p.conns[0].closed {
+		t.Error("conn that returned ErrBadConn was not closed")
+	}
+}
+
+func TestTxQuery(t *testing.T) {
+	ctx := context.Background()
+	p := &apiConnector{}
+	db := OpenDB(p)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "insert"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := tx.QueryContext(ctx, "select")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scanAll(t, rows); len(got) != 2 {
+		t.Errorf("rows = %q", got)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.QueryContext(ctx, "select"); err != ErrTxDone {
+		t.Errorf("QueryContext after Commit err = %v; want ErrTxDone", err)
+	}
+	if c := p.conns[0]; len(c.execs) != 1 || c.execs[0] != "insert" || c.txs != 1 {
+		t.Errorf("execs = %q, txs = %d", c.execs, c.txs)
+	}
+}
+
+func TestConnQuery(t *testing.T) {
+	ctx := context.Background()
+	p := &apiConnector{}
+	db := OpenDB(p)
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExecContext(ctx, "e"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := c.QueryContext(ctx, "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanAll(t, rows)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExecContext(ctx, "e"); err != ErrConnDone {
+		t.Errorf("ExecContext after Close err = %v; want ErrConnDone", err)
+	}
+	if err := c.Close(); err != ErrConnDone {
+		t.Errorf("second Close err = %v; want ErrConnDone", err)
+	}
+
+	// 坏连接被关闭, Conn随之失效
+	c, _ = db.Conn(ctx)
+	if _, err := c.ExecContext(ctx, "bad"); err != driver.ErrBadConn {
+		t.Fatalf("ExecContext err = %v; want ErrBadConn", err)
+	}
+	if _, err := c.QueryContext(ctx, "q"); err != ErrConnDone {
+		t.Errorf("QueryContext after ErrBadConn err = %v; want ErrConnDone", err)
+	}
+}
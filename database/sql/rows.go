@@ -0,0 +1,247 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"reflect"
+	"runtime"
+	"strconv"
+)
+
+type Rows struct {
+	rowsi driver.Rows
+	cancel context.CancelFunc
+	releaseConn func(error)
+
+	times TimePolicy
+
+	closed bool
+	lasterr error
+	lastcols []driver.Value
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (driver.Result, error) {
+	qctx, cancel := db.queryContext(ctx)
+	defer cancel()
+	ci, err := db.connect(qctx)
+	if err != nil {
+		return nil, timeoutErr(ctx, qctx, err, ErrQueryTimeout)
+	}
+	nvargs, err := db.driverArgs(ci, args)
+	if err != nil {
+		db.putConn(ci, err)
+		return nil, err
+	}
+	res, err := ctxDriverConnExec(qctx, ci, query, nvargs)
+	db.putConn(ci, err)
+	return res, timeoutErr(ctx, qctx, err, ErrQueryTimeout)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	ci, err := db.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Rows持有连接直到Close, 忘记关闭的Rows同样按泄露报告
+	ld := db.leakDetector()
+	trace := ld.track("Rows")
+	rows, err := queryConn(ctx, nil, db, ci, query, args, func(err error) {
+		ld.release(trace)
+		db.putConn(ci, err)
+	})
+	if err != nil {
+		ld.release(trace)
+		db.putConn(ci, err)
+		return nil, err
+	}
+	if trace != nil {
+		runtime.SetFinalizer(rows, func(*Rows) { ld.collected(trace) })
+	}
+	return rows, nil
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	if tx.isDone() {
+		return nil, ErrTxDone
+	}
+	if tx.expired() {
+		return nil, ErrTxTimeout
+	}
+	rows, err := queryConn(ctx, tx.ctx, tx.db, tx.ci, query, args, func(error) {})
+	if isBadConn(err) {
+		tx.abandon(err)
+	}
+	return rows, err
+}
+
+// 查询超时覆盖整个结果集的读取过程, 直到Rows被关闭
+// 在事务中时txctx为事务的ctx, 否则为nil
+func queryConn(ctx, txctx context.Context, db *DB, ci driver.Conn, query string,
+		args []interface{}, releaseConn func(error)) (*Rows, error) {
+	nvargs, err := db.driverArgs(ci, args)
+	if err != nil {
+		return nil, err
+	}
+	qctx, cancel := stmtContext(db, ctx, txctx)
+	rowsi, done, err := ctxDriverConnQuery(qctx, ci, query, nvargs)
+	if err != nil {
+		cancel()
+		return nil, stmtTimeoutErr(ctx, qctx, txctx, err)
+	}
+	return &Rows{
+		rowsi: rowsi,
+		times: db.timePolicy(),
+		cancel: cancel,
+		releaseConn: func(err error) {
+			done()
+			releaseConn(err)
+		},
+	}, nil
+}
+
+func newRows(db *DB, rowsi driver.Rows) *Rows {
+	return &Rows{rowsi: rowsi, times: db.timePolicy(), cancel: func() {}, releaseConn: func(error) {}}
+}
+
+func (rs *Rows) Next() bool {
+	if rs.closed {
+		return false
+	}
+	if rs.lastcols == nil {
+		rs.lastcols = make([]driver.Value, len(rs.rowsi.Columns()))
+	}
+	rs.lasterr = rs.rowsi.Next(rs.lastcols)
+	if rs.lasterr != nil {
+		rs.Close()
+		return false
+	}
+	return true
+}
+
+func (rs *Rows) Err() error {
+	if rs.lasterr == io.EOF {
+		return nil
+	}
+	return rs.lasterr
+}
+
+func (rs *Rows) Columns() ([]string, error) {
+	if rs.closed {
+		return nil, errors.New("sql: Rows are closed")
+	}
+	return rs.rowsi.Columns(), nil
+}
+
+// 列的类型信息, 驱动未提供的部分通过ok返回值区分
+type ColumnType struct {
+	name string
+
+	hasNullable bool
+	hasLength bool
+	hasPrecisionScale bool
+
+	nullable bool
+	length int64
+	databaseType string
+	precision int64
+	scale int64
+	scanType reflect.Type
+}
+
+func (ci *ColumnType) Name() string {
+	return ci.name
+}
+
+func (ci *ColumnType) Length() (length int64, ok bool) {
+	return ci.length, ci.hasLength
+}
+
+func (ci *ColumnType) DecimalSize() (precision, scale int64, ok bool) {
+	return ci.precision, ci.scale, ci.hasPrecisionScale
+}
+
+// 驱动未实现driver.RowsColumnTypeScanType时为interface{}的类型
+func (ci *ColumnType) ScanType() reflect.Type {
+	return ci.scanType
+}
+
+func (ci *ColumnType) Nullable() (nullable, ok bool) {
+	return ci.nullable, ci.hasNullable
+}
+
+// 数据库中的类型名, 如"VARCHAR", "BIGINT", 驱动不支持时为空字符串
+func (ci *ColumnType) DatabaseTypeName() string {
+	return ci.databaseType
+}
+
+func (rs *Rows) ColumnTypes() ([]*ColumnType, error) {
+	if rs.closed {
+		return nil, errors.New("sql: Rows are closed")
+	}
+	return rowsColumnInfoSetup(rs.rowsi), nil
+}
+
+func rowsColumnInfoSetup(rowsi driver.Rows) []*ColumnType {
+	names := rowsi.Columns()
+	list := make([]*ColumnType, len(names))
+	for i := range list {
+		ci := &ColumnType{
+			name: names[i],
+		}
+		list[i] = ci
+		if prop, ok := rowsi.(driver.RowsColumnTypeScanType); ok {
+			ci.scanType = prop.ColumnTypeScanType(i)
+		} else {
+			ci.scanType = reflect.TypeOf(new(interface{})).Elem()
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypeDatabaseTypeName); ok {
+			ci.databaseType = prop.ColumnTypeDatabaseTypeName(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypeLength); ok {
+			ci.length, ci.hasLength = prop.ColumnTypeLength(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypeNullable); ok {
+			ci.nullable, ci.hasNullable = prop.ColumnTypeNullable(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypePrecisionScale); ok {
+			ci.precision, ci.scale, ci.hasPrecisionScale = prop.ColumnTypePrecisionScale(i)
+		}
+	}
+	return list
+}
+
+func (rs *Rows) Scan(dest ...interface{}) error {
+	if rs.closed {
+		return errors.New("sql: Rows are closed")
+	}
+	if rs.lastcols == nil {
+		return errors.New("sql: Scan called without calling Next")
+	}
+	if len(dest) != len(rs.lastcols) {
+		return errors.New("sql: expected " + strconv.Itoa(len(rs.lastcols)) +
+			" destination arguments in Scan, not " + strconv.Itoa(len(dest)))
+	}
+	for i, sv := range rs.lastcols {
+		if err := convertAssign(dest[i], rs.times.scanValue(dest[i], sv)); err != nil {
+			return errors.New("sql: Scan error on column index " + strconv.Itoa(i) + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (rs *Rows) Close() error {
+	if rs.closed {
+		return nil
+	}
+	rs.closed = true
+	err := rs.rowsi.Close()
+	rs.cancel()
+	if rs.lasterr != nil && rs.lasterr != io.EOF {
+		rs.releaseConn(rs.lasterr)
+	} else {
+		rs.releaseConn(err)
+	}
+	return err
+}
@@ -1,6 +1,8 @@
 package sql
 
 import (
+	"context"
+	"errors"
 	"github.com/dimdark/gdk/database/sql/driver"
 	"sort"
 	"strconv"
@@ -92,6 +94,76 @@ type TxOptions struct {
 	ReadOnly bool
 }
 
+type BatchError struct {
+	Index int
+	Err error
+}
+func (e *BatchError) Error() string {
+	if e.Index < 0 {
+		return "sql: batch failed: " + e.Err.Error()
+	}
+	return "sql: batch failed at row " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+func parameterConverter(ci driver.Conn) driver.ValueConverter {
+	var vt *driver.ValueTypes
+	if p, ok := ci.(driver.ValueTypesProvider); ok {
+		vt = p.ValueTypes()
+	}
+	if u, ok := ci.(driver.Uint64Supporter); ok && u.SupportsUint64() {
+		return vt.Uint64ParameterConverter()
+	}
+	if vt != nil {
+		return vt.ParameterConverter()
+	}
+	return driver.DefaultParameterConverter
+}
+
+func (db *DB) driverArgs(ci driver.Conn, args []interface{}) ([]driver.NamedValue, error) {
+	cv := parameterConverter(ci)
+	times := db.timePolicy()
+	nvargs := make([]driver.NamedValue, len(args))
+	for n, arg := range args {
+		nv := &nvargs[n]
+		nv.Ordinal = n + 1
+		if np, ok := arg.(NamedArg); ok {
+			nv.Name = np.Name
+			arg = np.Value
+		}
+		v, err := cv.ConvertValue(arg)
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := v.(time.Time); ok {
+			v = times.normalize(t)
+		}
+		nv.Value = v
+	}
+	return nvargs, nil
+}
+
+func isBadConn(err error) bool {
+	if be, ok := err.(*BatchError); ok {
+		err = be.Err
+	}
+	if _, ok := err.(*abandonedCallError); ok {
+		return true
+	}
+	return err == driver.ErrBadConn
+}
+
+func (db *DB) batchArgs(ci driver.Conn, rows [][]interface{}) ([][]driver.NamedValue, error) {
+	nvrows := make([][]driver.NamedValue, len(rows))
+	for i, args := range rows {
+		nvargs, err := db.driverArgs(ci, args)
+		if err != nil {
+			return nil, &BatchError{Index: i, Err: err}
+		}
+		nvrows[i] = nvargs
+	}
+	return nvrows, nil
+}
+
 type RawBytes []byte
 
 type Scanner interface {
@@ -137,6 +209,25 @@ func (n *NullInt64) Value() (driver.Value, error) {
 	return n.Int64, nil
 }
 
+type NullUint64 struct {
+	Uint64 uint64
+	Valid bool
+}
+func (n *NullUint64) Scan(value interface{}) error {
+	if value == nil {
+		n.Uint64, n.Valid = 0, false
+		return nil
+	}
+	n.Valid = true
+	return convertAssign(&n.Uint64, value)
+}
+func (n NullUint64) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Uint64, nil
+}
+
 type NullFloat64 struct {
 	Float64 float64
 	Valid bool
@@ -182,6 +273,301 @@ type DB struct {
 
 	mu sync.Mutex
 	freeConn []*driverConn
+	maxIdle int
+	closed bool
+	queryTimeout time.Duration
+	txTimeout time.Duration
+	hooks ConnHooks
+	leaks *leakDetector
+	times TimePolicy
+	txRetries int
+	txRetryBackoff time.Duration
+	cancelGrace time.Duration
+}
+
+type ConnHooks struct {
+	// 新建连接后调用, 可用于设置时区、search_path等会话参数
+	OnConnect func(ctx context.Context, ci driver.Conn) error
+	// 取出连接时调用, 返回错误则丢弃该连接
+	OnCheckout func(ctx context.Context, ci driver.Conn) error
+	OnCheckin func(ci driver.Conn, err error)
+	OnClose func(ci driver.Conn, err error)
+}
+
+func (db *DB) SetConnHooks(hooks ConnHooks) {
+	db.mu.Lock()
+	db.hooks = hooks
+	db.mu.Unlock()
+}
+
+func (db *DB) connHooks() ConnHooks {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.hooks
+}
+
+var (
+	ErrQueryTimeout = errors.New("sql: query exceeded the default query timeout")
+	ErrTxTimeout = errors.New("sql: transaction exceeded the default transaction timeout")
+)
+
+// d <= 0 表示不设置默认超时
+func (db *DB) SetQueryTimeout(d time.Duration) {
+	db.mu.Lock()
+	db.queryTimeout = d
+	db.mu.Unlock()
+}
+
+func (db *DB) SetTxTimeout(d time.Duration) {
+	db.mu.Lock()
+	db.txTimeout = d
+	db.mu.Unlock()
+}
+
+// 旧接口驱动的调用被取消后, 最多再等待d让它返回, 超过后放弃该调用并丢弃连接;
+// d <= 0 时使用默认值5s
+func (db *DB) SetCancelGracePeriod(d time.Duration) {
+	db.mu.Lock()
+	db.cancelGrace = d
+	db.mu.Unlock()
+}
+
+func (db *DB) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	db.mu.Lock()
+	d := db.queryTimeout
+	grace := db.cancelGrace
+	db.mu.Unlock()
+	return withDefaultTimeout(withCancelGrace(ctx, grace), d)
+}
+
+func (db *DB) txContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	db.mu.Lock()
+	d := db.txTimeout
+	db.mu.Unlock()
+	return withDefaultTimeout(ctx, d)
+}
+
+func withDefaultTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// 区分默认超时与调用方的ctx或驱动本身返回的错误
+func timeoutErr(parent, ctx context.Context, err, timeout error) error {
+	if err != nil && parent.Err() == nil && ctx.Err() == context.DeadlineExceeded {
+		return timeout
+	}
+	return err
+}
+
+func OpenDB(c driver.Connector) *DB {
+	return &DB{connector: c}
+}
+
+var errDBClosed = errors.New("sql: database is closed")
+
+const defaultMaxIdleConns = 2
+
+// 空闲连接
+type driverConn struct {
+	ci driver.Conn
+	returnedAt time.Time
+}
+
+// n <= 0 表示不保留空闲连接
+func (db *DB) SetMaxIdleConns(n int) {
+	db.mu.Lock()
+	if n <= 0 {
+		db.maxIdle = -1
+	} else {
+		db.maxIdle = n
+	}
+	var closing []*driverConn
+	if max := db.maxIdleLocked(); len(db.freeConn) > max {
+		closing = db.freeConn[max:]
+		db.freeConn = db.freeConn[:max:max]
+	}
+	hooks := db.hooks
+	db.mu.Unlock()
+	for _, dc := range closing {
+		db.closeConn(hooks, dc.ci)
+	}
+}
+
+func (db *DB) maxIdleLocked() int {
+	switch {
+	case db.maxIdle == 0:
+		return defaultMaxIdleConns
+	case db.maxIdle < 0:
+		return 0
+	}
+	return db.maxIdle
+}
+
+// 关闭所有空闲连接, 已取出的连接在归还时关闭
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil
+	}
+	db.closed = true
+	free := db.freeConn
+	db.freeConn = nil
+	hooks := db.hooks
+	leaks := db.leaks
+	db.leaks = nil
+	db.mu.Unlock()
+	leaks.close()
+	var err error
+	for _, dc := range free {
+		if cerr := db.closeConn(hooks, dc.ci); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// 优先复用最近归还的空闲连接, 没有时新建连接并调用OnConnect;
+// OnCheckout拒绝或重置会话失败的空闲连接被关闭, 然后换一个连接重试,
+// 新建的连接被拒绝时直接返回错误, 避免不断新建注定被拒绝的连接
+func (db *DB) connect(ctx context.Context) (driver.Conn, error) {
+	for {
+		select {
+		default:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		db.mu.Lock()
+		if db.closed {
+			db.mu.Unlock()
+			return nil, errDBClosed
+		}
+		hooks := db.hooks
+		var dc *driverConn
+		if n := len(db.freeConn); n > 0 {
+			dc = db.freeConn[n-1]
+			db.freeConn[n-1] = nil
+			db.freeConn = db.freeConn[:n-1]
+		}
+		db.mu.Unlock()
+
+		if dc == nil {
+			return db.newConn(ctx, hooks)
+		}
+		if err := db.checkout(ctx, hooks, dc.ci); err != nil {
+			db.closeConn(hooks, dc.ci)
+			continue
+		}
+		return dc.ci, nil
+	}
+}
+
+func (db *DB) newConn(ctx context.Context, hooks ConnHooks) (driver.Conn, error) {
+	ci, err := db.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if hooks.OnConnect != nil {
+		if err := hooks.OnConnect(ctx, ci); err != nil {
+			db.closeConn(hooks, ci)
+			return nil, err
+		}
+	}
+	if hooks.OnCheckout != nil {
+		if err := hooks.OnCheckout(ctx, ci); err != nil {
+			db.closeConn(hooks, ci)
+			return nil, err
+		}
+	}
+	return ci, nil
+}
+
+func (db *DB) checkout(ctx context.Context, hooks ConnHooks, ci driver.Conn) error {
+	if rs, is := ci.(driver.SessionResetter); is {
+		if err := rs.ResetSession(ctx); err != nil {
+			return err
+		}
+	}
+	if hooks.OnCheckout != nil {
+		return hooks.OnCheckout(ctx, ci)
+	}
+	return nil
+}
+
+// 连接用完后归还, err为使用连接时最后的错误, 坏连接以及超出空闲上限的连接被关闭
+func (db *DB) putConn(ci driver.Conn, err error) error {
+	hooks := db.connHooks()
+	if hooks.OnCheckin != nil {
+		hooks.OnCheckin(ci, err)
+	}
+	if ae, ok := abandonedCall(err); ok {
+		// 被放弃的调用仍在使用连接, 等它返回后再关闭
+		go func() {
+			<-ae.done
+			db.closeConn(hooks, ci)
+		}()
+		return nil
+	}
+	if !isBadConn(err) {
+		db.mu.Lock()
+		if !db.closed && len(db.freeConn) < db.maxIdleLocked() {
+			db.freeConn = append(db.freeConn, &driverConn{ci: ci, returnedAt: time.Now()})
+			db.mu.Unlock()
+			return nil
+		}
+		db.mu.Unlock()
+	}
+	return db.closeConn(hooks, ci)
+}
+
+func (db *DB) closeConn(hooks ConnHooks, ci driver.Conn) error {
+	err := ci.Close()
+	if hooks.OnClose != nil {
+		hooks.OnClose(ci, err)
+	}
+	return err
+}
+
+func (db *DB) PingContext(ctx context.Context) error {
+	ci, err := db.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if pinger, ok := ci.(driver.Pinger); ok {
+		err = pinger.Ping(ctx)
+	}
+	db.putConn(ci, err)
+	return err
+}
+
+// 返回驱动支持的隔离级别; 返回nil表示驱动没有声明, 任何级别都交给驱动在开始事务时判断
+func (db *DB) SupportedIsolationLevels(ctx context.Context) ([]IsolationLevel, error) {
+	ci, err := db.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.putConn(ci, nil)
+	return driverIsolationLevels(ci), nil
+}
+
+func (db *DB) ExecBatch(ctx context.Context, query string, rows [][]interface{}) (driver.Result, error) {
+	qctx, cancel := db.queryContext(ctx)
+	defer cancel()
+	ci, err := db.connect(qctx)
+	if err != nil {
+		return nil, timeoutErr(ctx, qctx, err, ErrQueryTimeout)
+	}
+	nvrows, err := db.batchArgs(ci, rows)
+	if err != nil {
+		db.putConn(ci, err)
+		return nil, err
+	}
+	res, err := ctxDriverExecBatch(qctx, ci, query, nvrows)
+	db.putConn(ci, err)
+	return res, timeoutErr(ctx, qctx, err, ErrQueryTimeout)
 }
 
 
@@ -0,0 +1,39 @@
+package sql
+
+import (
+	"github.com/dimdark/gdk/database/sql/driver"
+	"testing"
+)
+
+type uint64Conn struct {
+	driver.Conn
+}
+
+func (uint64Conn) SupportsUint64() bool {
+	return true
+}
+
+func TestNullUint64Parameter(t *testing.T) {
+	db := &DB{}
+	nvargs, err := db.driverArgs(uint64Conn{}, []interface{}{
+		&NullUint64{Uint64: 1 << 63, Valid: true},
+		&NullUint64{},
+		NullUint64{Uint64: 1 << 63, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nvargs[0].Value != uint64(1<<63) {
+		t.Errorf("valid NullUint64 converted to %v (%T); want uint64(1<<63)", nvargs[0].Value, nvargs[0].Value)
+	}
+	if nvargs[1].Value != nil {
+		t.Errorf("invalid NullUint64 converted to %v; want nil", nvargs[1].Value)
+	}
+	if nvargs[2].Value != uint64(1<<63) {
+		t.Errorf("NullUint64 passed by value converted to %v (%T); want uint64(1<<63)", nvargs[2].Value, nvargs[2].Value)
+	}
+	nvargs, err = db.driverArgs(nil, []interface{}{&NullUint64{Uint64: 42, Valid: true}})
+	if err != nil || nvargs[0].Value != int64(42) {
+		t.Errorf("NullUint64 without uint64 support = %v, %v; want int64(42)", nvargs, err)
+	}
+}
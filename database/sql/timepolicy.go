@@ -0,0 +1,97 @@
+package sql
+
+import (
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/database/sql/driver/textcodec"
+	"time"
+)
+
+// time.Time参数和结果的处理方式
+type TimePolicy struct {
+	// 发送和读取时统一转换到该时区, nil表示不转换
+	Location *time.Location
+	// 发送前截断到数据库支持的精度, 如time.Microsecond, 0表示不截断
+	Precision time.Duration
+	// 将文本形式的时间扫描到time.Time时依次尝试的格式, 为空时使用driver.TimeLayouts
+	Layouts []string
+}
+
+func (db *DB) SetTimePolicy(p TimePolicy) {
+	db.mu.Lock()
+	db.times = p
+	db.mu.Unlock()
+}
+
+func (db *DB) timePolicy() TimePolicy {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.times
+}
+
+func (p TimePolicy) normalize(t time.Time) time.Time {
+	if p.Location != nil {
+		t = t.In(p.Location)
+	}
+	if p.Precision > 0 {
+		t = t.Truncate(p.Precision)
+	}
+	return t
+}
+
+func (p TimePolicy) parse(s string) (time.Time, bool) {
+	layouts := p.Layouts
+	if len(layouts) == 0 {
+		layouts = driver.TimeLayouts
+	}
+	for _, layout := range layouts {
+		loc := p.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// 自定义的Layouts优先; 之后直接按textcodec支持的格式解析, 都使用Location作为默认时区
+func (p TimePolicy) parseText(b []byte) (time.Time, bool) {
+	if len(p.Layouts) > 0 {
+		if t, ok := p.parse(string(b)); ok {
+			return t, true
+		}
+	}
+	if t, err := textcodec.ParseTime(b, p.Location); err == nil {
+		return t, true
+	}
+	if len(p.Layouts) == 0 {
+		return p.parse(string(b))
+	}
+	return time.Time{}, false
+}
+
+// 扫描前按策略处理来自数据库的值: time.Time无论目标类型都转换到Location,
+// 因此Scanner、*interface{}和*string等目标得到的也是同一时区的时间;
+// 文本只有在目标为*time.Time时才按Layouts解析, 其余目标仍按原文本扫描
+func (p TimePolicy) scanValue(dest, src interface{}) interface{} {
+	switch s := src.(type) {
+	case time.Time:
+		if p.Location != nil {
+			return s.In(p.Location)
+		}
+	case string:
+		if _, ok := dest.(*time.Time); ok {
+			if t, ok := p.parseText([]byte(s)); ok {
+				return t
+			}
+		}
+	case []byte:
+		if _, ok := dest.(*time.Time); ok {
+			if t, ok := p.parseText(s); ok {
+				return t
+			}
+		}
+	}
+	return src
+}
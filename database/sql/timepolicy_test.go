@@ -0,0 +1,173 @@
+package sql
+
+import (
+	"context"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"github.com/dimdark/gdk/io"
+	"testing"
+	"time"
+)
+
+// 查询返回一行row, 执行时记录收到的参数
+type timeConn struct {
+	driver.Conn
+	row []driver.Value
+	args []driver.NamedValue
+}
+
+func (c *timeConn) Close() error { return nil }
+func (c *timeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.args = args
+	return driver.RowsAffected(1), nil
+}
+func (c *timeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &timeRows{row: c.row}, nil
+}
+
+type timeRows struct {
+	row []driver.Value
+}
+
+func (r *timeRows) Columns() []string { return make([]string, len(r.row)) }
+func (r *timeRows) Close() error      { return nil }
+func (r *timeRows) Next(dest []driver.Value) error {
+	if r.row == nil {
+		return io.EOF
+	}
+	copy(dest, r.row)
+	r.row = nil
+	return nil
+}
+
+type timeConnector struct {
+	c *timeConn
+}
+
+func (p timeConnector) Connect(context.Context) (driver.Conn, error) { return p.c, nil }
+func (p timeConnector) Driver() driver.Driver                        { return nil }
+
+type timeScanner struct {
+	t time.Time
+}
+
+func (s *timeScanner) Scan(src interface{}) error {
+	s.t, _ = src.(time.Time)
+	return nil
+}
+
+// 通过DB查询c.row并扫描到dest
+func scanRow(t *testing.T, db *DB, dest ...interface{}) error {
+	t.Helper()
+	rows, err := db.QueryContext(context.Background(), "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatal("no rows")
+	}
+	return rows.Scan(dest...)
+}
+
+func TestTimePolicyScanAnyDest(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := &timeConn{row: []driver.Value{ts, ts, ts, ts}}
+	db := OpenDB(timeConnector{c})
+	db.SetTimePolicy(TimePolicy{Location: loc})
+	var (
+		tv time.Time
+		iv interface{}
+		sv string
+		sc timeScanner
+	)
+	if err := scanRow(t, db, &tv, &iv, &sv, &sc); err != nil {
+		t.Fatal(err)
+	}
+	if tv.Location() != loc || !tv.Equal(ts) {
+		t.Errorf("*time.Time = %v; want %v", tv, ts.In(loc))
+	}
+	if it, ok := iv.(time.Time); !ok || it.Location() != loc {
+		t.Errorf("*interface{} = %v; want %v", iv, ts.In(loc))
+	}
+	if want := ts.In(loc).Format(time.RFC3339Nano); sv != want {
+		t.Errorf("*string = %q; want %q", sv, want)
+	}
+	if sc.t.Location() != loc {
+		t.Errorf("Scanner got %v; want %v", sc.t, ts.In(loc))
+	}
+
+	// 文本扫描到string时保持原样
+	c.row = []driver.Value{"2020-01-02 03:04:05"}
+	if err := scanRow(t, db, &sv); err != nil || sv != "2020-01-02 03:04:05" {
+		t.Errorf("text scanned into *string = %q, %v", sv, err)
+	}
+}
+
+func TestTimePolicyParams(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	c := &timeConn{}
+	db := OpenDB(timeConnector{c})
+	db.SetTimePolicy(TimePolicy{Location: loc, Precision: time.Microsecond})
+	if _, err := db.ExecContext(context.Background(), "q", ts, Named("at", ts), "x"); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2020, 1, 2, 11, 4, 5, 123456000, loc)
+	for i := 0; i < 2; i++ {
+		got, ok := c.args[i].Value.(time.Time)
+		if !ok || !got.Equal(want) || got.Location() != loc || got.Nanosecond() != 123456000 {
+			t.Errorf("arg %d = %v; want %v", i, c.args[i].Value, want)
+		}
+	}
+	if c.args[1].Name != "at" || c.args[2].Value != "x" {
+		t.Errorf("args = %v; want the name and other values unchanged", c.args)
+	}
+
+	// 零值策略不修改参数
+	db.SetTimePolicy(TimePolicy{})
+	if _, err := db.ExecContext(context.Background(), "q", ts); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.args[0].Value.(time.Time); got != ts {
+		t.Errorf("arg = %v; want %v unchanged", got, ts)
+	}
+}
+
+func TestTimePolicyLayouts(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	c := &timeConn{row: []driver.Value{[]byte("02/01/2020 03:04")}}
+	db := OpenDB(timeConnector{c})
+	db.SetTimePolicy(TimePolicy{Location: loc, Layouts: []string{"02/01/2006 15:04"}})
+	var got time.Time
+	if err := scanRow(t, db, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2020, 1, 2, 3, 4, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("custom layout scanned as %v; want %v", got, want)
+	}
+	// 不符合任何格式的文本扫描失败
+	c.row = []driver.Value{"Jan 2 2020"}
+	if err := scanRow(t, db, &got); err == nil {
+		t.Errorf("text matching no layout scanned as %v", got)
+	}
+}
+
+func TestTimePolicyTextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	want := time.Date(2020, 1, 2, 3, 4, 5, 0, loc)
+	for _, p := range []TimePolicy{{Location: loc}, {Location: loc, Layouts: []string{"02/01/2006"}}} {
+		for _, src := range []driver.Value{[]byte("2020-01-02 03:04:05"), "2020-01-02 03:04:05"} {
+			c := &timeConn{row: []driver.Value{src}}
+			db := OpenDB(timeConnector{c})
+			db.SetTimePolicy(p)
+			var got time.Time
+			if err := scanRow(t, db, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("policy %v scanned %T text as %v; want %v", p.Layouts, src, got, want)
+			}
+		}
+	}
+}
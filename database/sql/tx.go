@@ -0,0 +1,355 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+var ErrTxDone = errors.New("sql: transaction has already been committed or rolled back")
+
+type Tx struct {
+	db *DB
+	ctx context.Context
+	cancel context.CancelFunc
+	ci driver.Conn
+	txi driver.Tx
+	releaseConn func(error)
+	done bool
+
+	// 嵌套事务通过保存点实现
+	parent *Tx
+	savepoint string
+	nested int
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *TxOptions) (*Tx, error) {
+	txctx, cancel := db.txContext(ctx)
+	ci, err := db.connect(txctx)
+	if err != nil {
+		cancel()
+		return nil, timeoutErr(ctx, txctx, err, ErrTxTimeout)
+	}
+	txi, err := ctxDriverBegin(txctx, opts, ci)
+	if err != nil {
+		cancel()
+		db.putConn(ci, err)
+		return nil, timeoutErr(ctx, txctx, err, ErrTxTimeout)
+	}
+	ld := db.leakDetector()
+	trace := ld.track("Tx")
+	tx := &Tx{
+		db: db,
+		ctx: txctx,
+		cancel: cancel,
+		ci: ci,
+		txi: txi,
+		releaseConn: func(err error) {
+			ld.release(trace)
+			db.putConn(ci, err)
+		},
+	}
+	if trace != nil {
+		runtime.SetFinalizer(tx, func(*Tx) { ld.collected(trace) })
+	}
+	return tx, nil
+}
+
+func (c *Conn) BeginTx(ctx context.Context, opts *TxOptions) (*Tx, error) {
+	if c.closed {
+		return nil, ErrConnDone
+	}
+	txctx, cancel := c.db.txContext(ctx)
+	txi, err := ctxDriverBegin(txctx, opts, c.ci)
+	if err != nil {
+		cancel()
+		return nil, timeoutErr(ctx, txctx, err, ErrTxTimeout)
+	}
+	return &Tx{
+		db: c.db,
+		ctx: txctx,
+		cancel: cancel,
+		ci: c.ci,
+		txi: txi,
+		releaseConn: func(error) {},
+	}, nil
+}
+
+func (tx *Tx) expired() bool {
+	return tx.ctx.Err() == context.DeadlineExceeded
+}
+
+func (tx *Tx) isDone() bool {
+	for t := tx; t != nil; t = t.parent {
+		if t.done {
+			return true
+		}
+	}
+	return false
+}
+
+func (tx *Tx) Commit() error {
+	if tx.isDone() {
+		return ErrTxDone
+	}
+	tx.done = true
+	if tx.parent != nil {
+		defer tx.cancel()
+		return tx.parent.Release(tx.savepoint)
+	}
+	defer tx.cancel()
+	if tx.expired() {
+		tx.txi.Rollback()
+		tx.releaseConn(ErrTxTimeout)
+		return ErrTxTimeout
+	}
+	err := tx.txi.Commit()
+	tx.releaseConn(err)
+	return err
+}
+
+func (tx *Tx) Rollback() error {
+	if tx.isDone() {
+		return ErrTxDone
+	}
+	tx.done = true
+	if tx.parent != nil {
+		defer tx.cancel()
+		if err := tx.parent.RollbackTo(tx.savepoint); err != nil {
+			return err
+		}
+		return tx.parent.Release(tx.savepoint)
+	}
+	defer tx.cancel()
+	err := tx.txi.Rollback()
+	tx.releaseConn(err)
+	return err
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (driver.Result, error) {
+	if tx.isDone() {
+		return nil, ErrTxDone
+	}
+	if tx.expired() {
+		return nil, ErrTxTimeout
+	}
+	nvargs, err := tx.db.driverArgs(tx.ci, args)
+	if err != nil {
+		return nil, err
+	}
+	qctx, cancel := stmtContext(tx.db, ctx, tx.ctx)
+	defer cancel()
+	res, err := ctxDriverConnExec(qctx, tx.ci, query, nvargs)
+	if isBadConn(err) {
+		tx.abandon(err)
+	}
+	return res, stmtTimeoutErr(ctx, qctx, tx.ctx, err)
+}
+
+// 语句使用的ctx: 调用方的ctx加上查询超时, 在事务中同时受事务超时约束, 先到期者生效
+func stmtContext(db *DB, ctx, txctx context.Context) (context.Context, context.CancelFunc) {
+	qctx, cancel := db.queryContext(ctx)
+	if txctx == nil {
+		return qctx, cancel
+	}
+	txdl, ok := txctx.Deadline()
+	if !ok {
+		return qctx, cancel
+	}
+	if dl, ok := qctx.Deadline(); ok && !txdl.Before(dl) {
+		return qctx, cancel
+	}
+	dctx, dcancel := context.WithDeadline(qctx, txdl)
+	return dctx, func() {
+		dcancel()
+		cancel()
+	}
+}
+
+// 与timeoutErr相同, 由事务超时导致时返回ErrTxTimeout
+func stmtTimeoutErr(parent, ctx, txctx context.Context, err error) error {
+	if err == nil || parent.Err() != nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if txctx != nil {
+		if txdl, ok := txctx.Deadline(); ok && !time.Now().Before(txdl) {
+			return ErrTxTimeout
+		}
+	}
+	return ErrQueryTimeout
+}
+
+// 连接已不可用, 结束整个事务并释放连接
+func (tx *Tx) abandon(err error) {
+	root := tx
+	for root.parent != nil {
+		root = root.parent
+	}
+	if root.done {
+		return
+	}
+	root.done = true
+	root.cancel()
+	root.releaseConn(err)
+}
+
+func (tx *Tx) Savepoint(name string) error {
+	if tx.isDone() {
+		return ErrTxDone
+	}
+	if !validSavepointName(name) {
+		return errors.New("sql: invalid savepoint name " + strconv.Quote(name))
+	}
+	if sp, is := tx.ci.(driver.Savepointer); is {
+		return sp.Savepoint(tx.ctx, name)
+	}
+	_, err := ctxDriverConnExec(tx.ctx, tx.ci, "SAVEPOINT "+name, nil)
+	return err
+}
+
+func (tx *Tx) RollbackTo(name string) error {
+	if tx.isDone() {
+		return ErrTxDone
+	}
+	if !validSavepointName(name) {
+		return errors.New("sql: invalid savepoint name " + strconv.Quote(name))
+	}
+	if sp, is := tx.ci.(driver.Savepointer); is {
+		return sp.RollbackTo(tx.ctx, name)
+	}
+	_, err := ctxDriverConnExec(tx.ctx, tx.ci, "ROLLBACK TO SAVEPOINT "+name, nil)
+	return err
+}
+
+func (tx *Tx) Release(name string) error {
+	if tx.isDone() {
+		return ErrTxDone
+	}
+	if !validSavepointName(name) {
+		return errors.New("sql: invalid savepoint name " + strconv.Quote(name))
+	}
+	if sp, is := tx.ci.(driver.Savepointer); is {
+		return sp.Release(tx.ctx, name)
+	}
+	_, err := ctxDriverConnExec(tx.ctx, tx.ci, "RELEASE SAVEPOINT "+name, nil)
+	return err
+}
+
+func (tx *Tx) BeginNested() (*Tx, error) {
+	root := tx
+	for root.parent != nil {
+		root = root.parent
+	}
+	// 保存点创建成功后才占用编号
+	name := "gdk_sp_" + strconv.Itoa(root.nested+1)
+	if err := tx.Savepoint(name); err != nil {
+		return nil, err
+	}
+	root.nested++
+	ctx, cancel := context.WithCancel(tx.ctx)
+	return &Tx{db: tx.db, ctx: ctx, cancel: cancel, ci: tx.ci, parent: tx, savepoint: name}, nil
+}
+
+func validSavepointName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	defaultTxRetries = 5
+	defaultTxRetryBackoff = 10 * time.Millisecond
+)
+
+// 设置RunInTx的最大重试次数和首次重试前的等待时间, 之后每次重试等待时间加倍.
+// maxRetries为0时使用默认值5, 小于0表示不重试; backoff <= 0 时使用默认值10ms
+func (db *DB) SetTxRetry(maxRetries int, backoff time.Duration) {
+	db.mu.Lock()
+	db.txRetries = maxRetries
+	db.txRetryBackoff = backoff
+	db.mu.Unlock()
+}
+
+func (db *DB) txRetry() (int, time.Duration) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	n, backoff := db.txRetries, db.txRetryBackoff
+	if n == 0 {
+		n = defaultTxRetries
+	} else if n < 0 {
+		n = 0
+	}
+	if backoff <= 0 {
+		backoff = defaultTxRetryBackoff
+	}
+	return n, backoff
+}
+
+func (db *DB) RunInTx(ctx context.Context, opts *TxOptions, fn func(*Tx) error) error {
+	maxRetries, backoff := db.txRetry()
+	for attempt := 0; ; attempt++ {
+		err := db.runTxOnce(ctx, opts, fn)
+		if err == nil || attempt == maxRetries || !isRetryable(err) {
+			return err
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (db *DB) runTxOnce(ctx context.Context, opts *TxOptions, fn func(*Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		if !tx.isDone() {
+			tx.Rollback()
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// 沿着错误链查找driver.RetryableError, 没有时按SQLSTATE判断
+func isRetryable(err error) bool {
+	for e := err; e != nil; {
+		if re, ok := e.(driver.RetryableError); ok {
+			return re.Retryable()
+		}
+		switch x := e.(type) {
+		case *BatchError:
+			e = x.Err
+		case interface{ Unwrap() error }:
+			e = x.Unwrap()
+		default:
+			e = nil
+		}
+	}
+	return IsSerializationFailure(err) || IsDeadlock(err)
+}
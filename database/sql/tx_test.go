@@ -0,0 +1,345 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/dimdark/gdk/database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// ExecContext和QueryContext一直阻塞到ctx结束
+type blockingConn struct {
+	driver.Conn
+}
+
+func (blockingConn) Begin() (driver.Tx, error) { return blockingConn{}, nil }
+func (blockingConn) Commit() error             { return nil }
+func (blockingConn) Rollback() error           { return nil }
+func (blockingConn) Close() error              { return nil }
+func (blockingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+func (blockingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type blockingConnector struct{}
+
+func (blockingConnector) Connect(context.Context) (driver.Conn, error) { return blockingConn{}, nil }
+func (blockingConnector) Driver() driver.Driver                        { return nil }
+
+func TestTxTimeoutBoundsStatements(t *testing.T) {
+	db := OpenDB(blockingConnector{})
+	db.SetTxTimeout(20 * time.Millisecond)
+	db.SetQueryTimeout(time.Minute)
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	start := time.Now()
+	if _, err := tx.ExecContext(context.Background(), "q"); err != ErrTxTimeout {
+		t.Errorf("ExecContext err = %v; want ErrTxTimeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("ExecContext ran for %v past the transaction timeout", d)
+	}
+
+	db.SetTxTimeout(time.Minute)
+	db.SetQueryTimeout(20 * time.Millisecond)
+	tx2, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx2.Rollback()
+	if _, err := tx2.QueryContext(context.Background(), "q"); err != ErrQueryTimeout {
+		t.Errorf("QueryContext err = %v; want ErrQueryTimeout", err)
+	}
+}
+
+// 记录事务的提交和回滚次数
+type retryConn struct {
+	driver.Conn
+	commits, rollbacks int
+}
+
+func (c *retryConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *retryConn) Close() error              { return nil }
+func (c *retryConn) Commit() error {
+	c.commits++
+	return nil
+}
+func (c *retryConn) Rollback() error {
+	c.rollbacks++
+	return nil
+}
+
+type retryConnector struct {
+	c *retryConn
+}
+
+func (p retryConnector) Connect(context.Context) (driver.Conn, error) { return p.c, nil }
+func (p retryConnector) Driver() driver.Driver                        { return nil }
+
+type retryErr struct{}
+
+func (retryErr) Error() string   { return "try again" }
+func (retryErr) Retryable() bool { return true }
+
+// 包装后的错误, 只能通过Unwrap找到retryErr
+type wrappedErr struct {
+	err error
+}
+
+func (e wrappedErr) Error() string { return "wrapped: " + e.err.Error() }
+func (e wrappedErr) Unwrap() error { return e.err }
+
+func TestRunInTxRetry(t *testing.T) {
+	c := &retryConn{}
+	db := OpenDB(retryConnector{c})
+	db.SetTxRetry(3, time.Millisecond)
+	attempts := 0
+	err := db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		attempts++
+		if attempts < 3 {
+			return wrappedErr{retryErr{}}
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("RunInTx = %v after %d attempts; want success on attempt 3", err, attempts)
+	}
+	if c.commits != 1 || c.rollbacks != 2 {
+		t.Errorf("commits = %d, rollbacks = %d; want 1, 2", c.commits, c.rollbacks)
+	}
+
+	// 超过重试次数后返回最后一次的错误
+	attempts = 0
+	err = db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		attempts++
+		return retryErr{}
+	})
+	if err != (retryErr{}) || attempts != 4 {
+		t.Errorf("RunInTx = %v after %d attempts; want retryErr after 4", err, attempts)
+	}
+
+	// 不可重试的错误直接返回
+	attempts = 0
+	fail := errors.New("fail")
+	err = db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		attempts++
+		return fail
+	})
+	if err != fail || attempts != 1 {
+		t.Errorf("RunInTx = %v after %d attempts; want fail after 1", err, attempts)
+	}
+
+	db.SetTxRetry(-1, 0)
+	attempts = 0
+	db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		attempts++
+		return retryErr{}
+	})
+	if attempts != 1 {
+		t.Errorf("RunInTx with retries disabled ran %d attempts", attempts)
+	}
+}
+
+func TestRunInTxCancelDuringBackoff(t *testing.T) {
+	db := OpenDB(retryConnector{&retryConn{}})
+	db.SetTxRetry(3, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := db.RunInTx(ctx, nil, func(tx *Tx) error {
+		attempts++
+		cancel()
+		return retryErr{}
+	})
+	if err != context.Canceled || attempts != 1 {
+		t.Errorf("RunInTx = %v after %d attempts; want context.Canceled after 1", err, attempts)
+	}
+}
+
+func TestRunInTxPanic(t *testing.T) {
+	c := &retryConn{}
+	db := OpenDB(retryConnector{c})
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v; want the panic to propagate", p)
+			}
+		}()
+		db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+			panic("boom")
+		})
+	}()
+	if c.commits != 0 || c.rollbacks != 1 {
+		t.Errorf("commits = %d, rollbacks = %d; want the transaction rolled back", c.commits, c.rollbacks)
+	}
+}
+
+// 记录执行的语句, failOn中的语句执行失败
+type nestConn struct {
+	driver.Conn
+	execs []string
+	failOn string
+}
+
+func (c *nestConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *nestConn) Close() error              { return nil }
+func (c *nestConn) Commit() error             { return nil }
+func (c *nestConn) Rollback() error           { return nil }
+func (c *nestConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if query == c.failOn {
+		return nil, errors.New("exec failed")
+	}
+	c.execs = append(c.execs, query)
+	return driver.RowsAffected(0), nil
+}
+
+// 通过driver.Savepointer创建保存点, 不执行SQL
+type spConn struct {
+	nestConn
+	calls []string
+}
+
+func (c *spConn) Savepoint(ctx context.Context, name string) error {
+	c.calls = append(c.calls, "savepoint "+name)
+	return nil
+}
+func (c *spConn) RollbackTo(ctx context.Context, name string) error {
+	c.calls = append(c.calls, "rollback to "+name)
+	return nil
+}
+func (c *spConn) Release(ctx context.Context, name string) error {
+	c.calls = append(c.calls, "release "+name)
+	return nil
+}
+
+type nestConnector struct {
+	c driver.Conn
+}
+
+func (p nestConnector) Connect(context.Context) (driver.Conn, error) { return p.c, nil }
+func (p nestConnector) Driver() driver.Driver                        { return nil }
+
+// 提交一个嵌套事务, 回滚另一个
+func nestedWorkload(t *testing.T, db *DB) {
+	t.Helper()
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	child, err := tx.BeginNested()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := child.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	child, err = tx.BeginNested()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := child.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBeginNestedSQL(t *testing.T) {
+	c := &nestConn{}
+	nestedWorkload(t, OpenDB(nestConnector{c}))
+	want := []string{
+		"SAVEPOINT gdk_sp_1",
+		"RELEASE SAVEPOINT gdk_sp_1",
+		"SAVEPOINT gdk_sp_2",
+		"ROLLBACK TO SAVEPOINT gdk_sp_2",
+		"RELEASE SAVEPOINT gdk_sp_2",
+	}
+	if !reflect.DeepEqual(c.execs, want) {
+		t.Errorf("execs = %q; want %q", c.execs, want)
+	}
+}
+
+func TestBeginNestedSavepointer(t *testing.T) {
+	c := &spConn{}
+	nestedWorkload(t, OpenDB(nestConnector{c}))
+	want := []string{
+		"savepoint gdk_sp_1",
+		"release gdk_sp_1",
+		"savepoint gdk_sp_2",
+		"rollback to gdk_sp_2",
+		"release gdk_sp_2",
+	}
+	if !reflect.DeepEqual(c.calls, want) || len(c.execs) != 0 {
+		t.Errorf("calls = %q, execs = %q; want %q and no SQL", c.calls, c.execs, want)
+	}
+}
+
+func TestBeginNestedAfterParentDone(t *testing.T) {
+	c := &nestConn{failOn: "SAVEPOINT gdk_sp_1"}
+	db := OpenDB(nestConnector{c})
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.BeginNested(); err == nil {
+		t.Fatal("BeginNested succeeded with a failing SAVEPOINT")
+	}
+	// 失败的保存点不占用编号
+	c.failOn = ""
+	child, err := tx.BeginNested()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child.savepoint != "gdk_sp_1" {
+		t.Errorf("savepoint = %s after a failed attempt; want gdk_sp_1", child.savepoint)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := child.ExecContext(context.Background(), "q"); err != ErrTxDone {
+		t.Errorf("ExecContext on child of a committed tx = %v; want ErrTxDone", err)
+	}
+	if err := child.Commit(); err != ErrTxDone {
+		t.Errorf("Commit on child of a committed tx = %v; want ErrTxDone", err)
+	}
+	if _, err := child.BeginNested(); err != ErrTxDone {
+		t.Errorf("BeginNested on child of a committed tx = %v; want ErrTxDone", err)
+	}
+}
+
+func TestSavepointNames(t *testing.T) {
+	c := &nestConn{}
+	db := OpenDB(nestConnector{c})
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, name := range []string{"", "1a", "a b", "a;DROP TABLE t", "a-b"} {
+		if err := tx.Savepoint(name); err == nil {
+			t.Errorf("Savepoint(%q) succeeded", name)
+		}
+		if err := tx.RollbackTo(name); err == nil {
+			t.Errorf("RollbackTo(%q) succeeded", name)
+		}
+		if err := tx.Release(name); err == nil {
+			t.Errorf("Release(%q) succeeded", name)
+		}
+	}
+	if len(c.execs) != 0 {
+		t.Errorf("invalid savepoint names reached the driver: %q", c.execs)
+	}
+	if err := tx.Savepoint("_sp1"); err != nil {
+		t.Errorf("Savepoint(_sp1) = %v", err)
+	}
+}
@@ -73,11 +73,11 @@ func (enc *Encoding) Encode(dst, src []byte) {
 	// 总共有n个基本单位
 	n := (len(src) / 3) * 3
 	for si < n {
-		val := uint(src[si+0] << 16) | uint(src[si+1] << 8) | uint(src[si+2])
-		dst[di+0] = byte(val >> 18)
-		dst[di+1] = byte(val >> 12)
-		dst[di+2] = byte(val >> 6)
-		dst[di+3] = byte(val)
+		val := uint(src[si+0]) << 16 | uint(src[si+1]) << 8 | uint(src[si+2])
+		dst[di+0] = enc.encode[val>>18&0x3F]
+		dst[di+1] = enc.encode[val>>12&0x3F]
+		dst[di+2] = enc.encode[val>>6&0x3F]
+		dst[di+3] = enc.encode[val&0x3F]
 		si += 3
 		di += 4
 	}
@@ -241,8 +241,92 @@ func (enc *Encoding) decode32(src []byte) (dn uint32, ok bool) {
 	return dn, true
 }
 
+// 从src[si]开始解码一组(最多4个字符), 跳过换行符并处理尾部填充
+// 返回下一组的起始位置nsi和写入dst的字节数n
 func (enc *Encoding) decodeQuantum(dst, src []byte, si int) (nsi, n int, err error) {
+	var dbuf [4]byte
+	dlen := 4
+
+	for j := 0; j < len(dbuf); j++ {
+		if len(src) == si {
+			switch {
+			case j == 0:
+				return si, 0, nil
+			case j == 1, enc.padChar != NoPadding:
+				return si, 0, CorruptInputError(si - j)
+			}
+			dlen = j
+			break
+		}
+		in := src[si]
+		si++
+
+		out := enc.decodeMap[in]
+		if out != 0xFF {
+			dbuf[j] = out
+			continue
+		}
+
+		if in == '\n' || in == '\r' {
+			j--
+			continue
+		}
 
+		if rune(in) != enc.padChar {
+			return si, 0, CorruptInputError(si - 1)
+		}
+
+		// 遇到填充字符, 说明已到结尾
+		switch j {
+		case 0, 1:
+			return si, 0, CorruptInputError(si - 1)
+		case 2:
+			// 需要"==", 第一个"="已经读取
+			for si < len(src) && (src[si] == '\n' || src[si] == '\r') {
+				si++
+			}
+			if si == len(src) {
+				return si, 0, CorruptInputError(len(src))
+			}
+			if rune(src[si]) != enc.padChar {
+				return si, 0, CorruptInputError(si - 1)
+			}
+			si++
+		}
+
+		for si < len(src) && (src[si] == '\n' || src[si] == '\r') {
+			si++
+		}
+		if si < len(src) {
+			// 填充之后还有多余的数据
+			err = CorruptInputError(si)
+		}
+		dlen = j
+		break
+	}
+
+	// 4个6bit还原为3个字节
+	val := uint(dbuf[0])<<18 | uint(dbuf[1])<<12 | uint(dbuf[2])<<6 | uint(dbuf[3])
+	dbuf[2], dbuf[1], dbuf[0] = byte(val>>0), byte(val>>8), byte(val>>16)
+	switch dlen {
+	case 4:
+		dst[2] = dbuf[2]
+		dbuf[2] = 0
+		fallthrough
+	case 3:
+		dst[1] = dbuf[1]
+		if enc.strict && dbuf[2] != 0 {
+			return si, 0, CorruptInputError(si - 1)
+		}
+		dbuf[1] = 0
+		fallthrough
+	case 2:
+		dst[0] = dbuf[0]
+		if enc.strict && (dbuf[1] != 0 || dbuf[2] != 0) {
+			return si, 0, CorruptInputError(si - 2)
+		}
+	}
+	return si, dlen - 1, err
 }
 
 type encoder struct {
@@ -254,6 +338,60 @@ type encoder struct {
 	out [1024]byte
 }
 
+func (e *encoder) Write(p []byte) (n int, err error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	// 先补齐上次剩余的不足3个字节的部分
+	if e.nbuf > 0 {
+		var i int
+		for i = 0; i < len(p) && e.nbuf < 3; i++ {
+			e.buf[e.nbuf] = p[i]
+			e.nbuf++
+		}
+		n += i
+		p = p[i:]
+		if e.nbuf < 3 {
+			return
+		}
+		e.enc.Encode(e.out[:], e.buf[:])
+		if _, e.err = e.w.Write(e.out[:4]); e.err != nil {
+			return n, e.err
+		}
+		e.nbuf = 0
+	}
+	for len(p) >= 3 {
+		nn := len(e.out) / 4 * 3
+		if nn > len(p) {
+			nn = len(p)
+			nn -= nn % 3
+		}
+		e.enc.Encode(e.out[:], p[:nn])
+		if _, e.err = e.w.Write(e.out[0 : nn/3*4]); e.err != nil {
+			return n, e.err
+		}
+		n += nn
+		p = p[nn:]
+	}
+	// 剩余不足3个字节的部分留到下次写入或Close
+	for i := 0; i < len(p); i++ {
+		e.buf[i] = p[i]
+	}
+	e.nbuf = len(p)
+	n += len(p)
+	return
+}
+
+// 写出剩余的部分(包括填充), 不会关闭底层的Writer
+func (e *encoder) Close() error {
+	if e.err == nil && e.nbuf > 0 {
+		e.enc.Encode(e.out[:], e.buf[:e.nbuf])
+		_, e.err = e.w.Write(e.out[:e.enc.EncodedLen(e.nbuf)])
+		e.nbuf = 0
+	}
+	return e.err
+}
+
 type decoder struct {
 	err error
 	readErr error
@@ -265,6 +403,65 @@ type decoder struct {
 	outbuf [1024 / 4 * 3]byte
 }
 
+func (d *decoder) Read(p []byte) (n int, err error) {
+	// 先返回上次解码剩余的数据
+	if len(d.out) > 0 {
+		n = copy(p, d.out)
+		d.out = d.out[n:]
+		return n, nil
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	for d.nbuf < 4 && d.readErr == nil {
+		nn := len(p) / 3 * 4
+		if nn < 4 {
+			nn = 4
+		}
+		if nn > len(d.buf) {
+			nn = len(d.buf)
+		}
+		nn, d.readErr = d.r.Read(d.buf[d.nbuf:nn])
+		d.nbuf += nn
+	}
+	if d.nbuf < 4 {
+		if d.enc.padChar == NoPadding && d.nbuf > 0 {
+			// 没有填充时最后一组可能不足4个字符
+			var nw int
+			nw, d.err = d.enc.Decode(d.outbuf[:], d.buf[:d.nbuf])
+			d.nbuf = 0
+			d.out = d.outbuf[:nw]
+			n = copy(p, d.out)
+			d.out = d.out[n:]
+			if n > 0 || len(p) == 0 && len(d.out) > 0 {
+				return n, nil
+			}
+			if d.err != nil {
+				return 0, d.err
+			}
+		}
+		d.err = d.readErr
+		if d.err == io.EOF && d.nbuf > 0 {
+			d.err = io.ErrUnexpectedEOF
+		}
+		return 0, d.err
+	}
+	// p放不下时先解码到outbuf
+	nr := d.nbuf / 4 * 4
+	nw := d.nbuf / 4 * 3
+	if nw > len(p) {
+		nw, d.err = d.enc.Decode(d.outbuf[:], d.buf[:nr])
+		d.out = d.outbuf[:nw]
+		n = copy(p, d.out)
+		d.out = d.out[n:]
+	} else {
+		n, d.err = d.enc.Decode(p, d.buf[:nr])
+	}
+	d.nbuf -= nr
+	copy(d.buf[:d.nbuf], d.buf[nr:])
+	return n, d.err
+}
+
 type CorruptInputError int64
 func (e CorruptInputError) Error() string {
 	return "illegal base64 data at input byte" + strconv.FormatInt(int64(e), 10)
@@ -278,7 +475,7 @@ func (r *newlineFilteringReader) Read(p []byte) (int, error) {
 	n, err := r.wrapped.Read(p)
 	for n > 0 {
 		offset := 0
-		for i, b := range p {
+		for i, b := range p[:n] {
 			if b != '\r' && b != '\n' {
 				if i != offset {
 					p[offset] = b
@@ -1 +1,54 @@
 package base64
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+var pairs = []struct {
+	decoded, encoded string
+}{
+	{"", ""},
+	{"f", "Zg=="},
+	{"fo", "Zm8="},
+	{"foo", "Zm9v"},
+	{"foob", "Zm9vYg=="},
+	{"fooba", "Zm9vYmE="},
+	{"foobar", "Zm9vYmFy"},
+	{"\x14\xfb\x9c\x03\xd9\x7e", "FPucA9l+"},
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, p := range pairs {
+		if got := StdEncoding.EncodeToString([]byte(p.decoded)); got != p.encoded {
+			t.Errorf("Encode(%q) = %q; want %q", p.decoded, got, p.encoded)
+		}
+		got, err := StdEncoding.DecodeString(p.encoded)
+		if err != nil || string(got) != p.decoded {
+			t.Errorf("Decode(%q) = %q, %v; want %q", p.encoded, got, err, p.decoded)
+		}
+	}
+	if _, err := StdEncoding.DecodeString("Zm9=v"); err == nil {
+		t.Errorf("Decode of corrupt input succeeded")
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	for _, p := range pairs {
+		var buf bytes.Buffer
+		w := NewEncoder(StdEncoding, &buf)
+		for i := 0; i < len(p.decoded); i++ {
+			w.Write([]byte{p.decoded[i]})
+		}
+		w.Close()
+		if buf.String() != p.encoded {
+			t.Errorf("NewEncoder(%q) wrote %q; want %q", p.decoded, buf.String(), p.encoded)
+		}
+		got, err := ioutil.ReadAll(NewDecoder(StdEncoding, &buf))
+		if err != nil && err != io.EOF || string(got) != p.decoded {
+			t.Errorf("NewDecoder(%q) = %q, %v; want %q", p.encoded, got, err, p.decoded)
+		}
+	}
+}